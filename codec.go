@@ -0,0 +1,199 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/render"
+	"github.com/go-playground/errors/v5"
+)
+
+// Codec encodes and decodes the entities of a media type
+type Codec interface {
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+// EncodeFunc encodes an entity
+type EncodeFunc func(w io.Writer, v interface{}) error
+
+// DecodeFunc decodes an entity
+type DecodeFunc func(r io.Reader, v interface{}) error
+
+// CodecFunc is a codec composed from an encoder and a decoder function
+type CodecFunc struct {
+	EncodeFunc EncodeFunc
+	DecodeFunc DecodeFunc
+}
+
+// Encode encodes an entity
+func (c *CodecFunc) Encode(w io.Writer, v interface{}) error {
+	return c.EncodeFunc(w, v)
+}
+
+// Decode decodes an entity
+func (c *CodecFunc) Decode(r io.Reader, v interface{}) error {
+	return c.DecodeFunc(r, v)
+}
+
+var (
+	codecMutex    sync.RWMutex
+	codecMap      = make(map[string]Codec)
+	codecDefaults = []struct {
+		mediaType string
+		codec     Codec
+	}{
+		{mediaType: "application/json", codec: &CodecFunc{EncodeFunc: codecEncodeJSON, DecodeFunc: render.DecodeJSON}},
+		{mediaType: "application/xml", codec: &CodecFunc{EncodeFunc: codecEncodeXML, DecodeFunc: render.DecodeXML}},
+		{mediaType: "text/xml", codec: &CodecFunc{EncodeFunc: codecEncodeXML, DecodeFunc: render.DecodeXML}},
+	}
+)
+
+// RegisterCodec registers the codec of the given media type. The registered
+// codecs take precedence over the JSON, XML and form support of Decode and
+// Respond.
+func RegisterCodec(mediaType string, codec Codec) {
+	codecMutex.Lock()
+	defer codecMutex.Unlock()
+
+	codecMap[codecKey(mediaType)] = codec
+}
+
+// UnregisterCodec removes the codec of the given media type
+func UnregisterCodec(mediaType string) {
+	codecMutex.Lock()
+	defer codecMutex.Unlock()
+
+	delete(codecMap, codecKey(mediaType))
+}
+
+// LookupCodec returns the codec of the given media type
+func LookupCodec(mediaType string) (Codec, bool) {
+	codecMutex.RLock()
+	defer codecMutex.RUnlock()
+
+	codec, ok := codecMap[codecKey(mediaType)]
+	return codec, ok
+}
+
+// codecRequest returns the codec of the request content type
+func codecRequest(r *http.Request) (Codec, bool) {
+	// the content type is forced by the SetContentType middleware
+	if _, ok := r.Context().Value(render.ContentTypeCtxKey).(render.ContentType); ok {
+		return nil, false
+	}
+
+	return LookupCodec(r.Header.Get("Content-Type"))
+}
+
+// codecResponse returns the content type and the codec of the media type
+// that is most preferred by the client
+func codecResponse(r *http.Request) (string, Codec, bool) {
+	codecMutex.RLock()
+	offers := make([]string, 0, len(codecMap)+len(codecDefaults))
+
+	for _, item := range codecDefaults {
+		offers = append(offers, item.mediaType)
+	}
+
+	for mediaType := range codecMap {
+		offers = append(offers, mediaType)
+	}
+	codecMutex.RUnlock()
+
+	// the default offers are followed by the registered ones in stable order
+	sort.Strings(offers[len(codecDefaults):])
+
+	offer, mediaType, ok := negotiate(r.Header.Get("Accept"), offers)
+	if !ok {
+		return "", nil, false
+	}
+
+	if codec, ok := LookupCodec(offer); ok {
+		return mediaType, codec, true
+	}
+
+	for _, item := range codecDefaults {
+		if item.mediaType == offer {
+			return mediaType + "; charset=utf-8", item.codec, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// codecRespond encodes the entity with the codec
+func codecRespond(w http.ResponseWriter, r *http.Request, contentType string, codec Codec, v interface{}) {
+	buffer := &bytes.Buffer{}
+
+	if err := codec.Encode(buffer, v); err != nil {
+		// the error of the encoder is logged but not exposed to the client
+		err = errors.Wrap(err, "encode").
+			AddTag("status", http.StatusInternalServerError).
+			AddTag("detail", "")
+
+		problemRespond(w, r, errorf(r, err))
+		return
+	}
+
+	status, ok := r.Context().Value(render.StatusCtxKey).(int)
+
+	// only the successful responses are cached
+	if (!ok || status == http.StatusOK) && etagRespond(w, r, buffer.Bytes()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+
+	if ok {
+		w.WriteHeader(status)
+	}
+
+	//nolint:errcheck
+	w.Write(buffer.Bytes())
+}
+
+func codecEncodeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(true)
+	return encoder.Encode(v)
+}
+
+func codecEncodeXML(w io.Writer, v interface{}) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	// the generic header is prepended if it is not found in the first 100 bytes
+	prefix := data
+	if len(prefix) > 100 {
+		prefix = prefix[:100]
+	}
+
+	if !bytes.Contains(prefix, []byte("<?xml")) {
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+func codecKey(value string) string {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.Split(value, ";")[0])
+	}
+
+	return strings.ToLower(mediaType)
+}
@@ -0,0 +1,99 @@
+package rest_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/phogolabs/rest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Codec", func() {
+	const mediaType = "application/x-gob"
+
+	var request *http.Request
+
+	BeforeEach(func() {
+		codec := &rest.CodecFunc{
+			EncodeFunc: func(w io.Writer, v interface{}) error {
+				return gob.NewEncoder(w).Encode(v)
+			},
+			DecodeFunc: func(r io.Reader, v interface{}) error {
+				return gob.NewDecoder(r).Decode(v)
+			},
+		}
+
+		rest.RegisterCodec(mediaType, codec)
+
+		buffer := &bytes.Buffer{}
+		Expect(gob.NewEncoder(buffer).Encode(&Contact{Phone: "+188123451"})).To(Succeed())
+
+		request = httptest.NewRequest("POST", "http://example.com", buffer)
+		request.Header.Set("Content-Type", mediaType+"; charset=utf-8")
+		request.Header.Set("Accept", "application/x-gob, application/json")
+	})
+
+	AfterEach(func() {
+		rest.UnregisterCodec(mediaType)
+	})
+
+	It("returns the codec", func() {
+		codec, ok := rest.LookupCodec("Application/X-Gob")
+		Expect(ok).To(BeTrue())
+		Expect(codec).NotTo(BeNil())
+	})
+
+	It("decodes the request with the codec", func() {
+		entity := Contact{}
+
+		Expect(rest.Decode(request, &entity)).To(Succeed())
+		Expect(entity.Phone).To(Equal("+188123451"))
+	})
+
+	It("encodes the response with the codec", func() {
+		recorder := httptest.NewRecorder()
+
+		rest.Respond(recorder, request, &Contact{Phone: "+188123451"})
+		Expect(recorder.Header().Get("Content-Type")).To(Equal(mediaType))
+
+		entity := Contact{}
+		Expect(gob.NewDecoder(recorder.Body).Decode(&entity)).To(Succeed())
+		Expect(entity.Phone).To(Equal("+188123451"))
+	})
+
+	Context("when the entity cannot be encoded", func() {
+		BeforeEach(func() {
+			rest.RegisterCodec(mediaType, &rest.CodecFunc{
+				EncodeFunc: func(w io.Writer, v interface{}) error {
+					return fmt.Errorf("gob: secret internals")
+				},
+			})
+		})
+
+		It("responds with a problem without the error of the encoder", func() {
+			recorder := httptest.NewRecorder()
+
+			rest.Respond(recorder, request, &Contact{Phone: "+188123451"})
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(recorder.Header().Get("Content-Type")).To(HavePrefix(rest.ContentTypeProblemJSON))
+			Expect(recorder.Body.String()).NotTo(ContainSubstring("secret internals"))
+		})
+	})
+
+	Context("when the codec is unregistered", func() {
+		BeforeEach(func() {
+			rest.UnregisterCodec(mediaType)
+		})
+
+		It("returns an error", func() {
+			entity := Contact{}
+			Expect(rest.Decode(request, &entity)).NotTo(Succeed())
+		})
+	})
+})
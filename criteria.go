@@ -0,0 +1,329 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-playground/errors/v5"
+	"github.com/go-playground/form/v4"
+)
+
+// Operator represents a filter operator
+type Operator string
+
+const (
+	// OperatorEq matches the values equal to the operand
+	OperatorEq Operator = "eq"
+	// OperatorNe matches the values not equal to the operand
+	OperatorNe Operator = "ne"
+	// OperatorGt matches the values greater than the operand
+	OperatorGt Operator = "gt"
+	// OperatorGte matches the values greater than or equal to the operand
+	OperatorGte Operator = "gte"
+	// OperatorLt matches the values less than the operand
+	OperatorLt Operator = "lt"
+	// OperatorLte matches the values less than or equal to the operand
+	OperatorLte Operator = "lte"
+	// OperatorIn matches the values in the comma separated operands
+	OperatorIn Operator = "in"
+	// OperatorNin matches the values not in the comma separated operands
+	OperatorNin Operator = "nin"
+	// OperatorLike matches the values with the operand pattern
+	OperatorLike Operator = "like"
+)
+
+// Criteria represents the filter and sort criteria of a list request
+type Criteria struct {
+	Filter []Condition
+	Sort   []Order
+}
+
+// Condition represents a filter condition, e.g. filter[age][gte]=18
+type Condition struct {
+	// Field is the name of the struct field
+	Field string
+	// Name is the name of the field in the query
+	Name string
+	// Operator is the filter operator
+	Operator Operator
+	// Value is the operand converted to the type of the struct field. It is a
+	// slice for the in and nin operators.
+	Value interface{}
+}
+
+// Order represents a sort order, e.g. sort=-created_at
+type Order struct {
+	// Field is the name of the struct field
+	Field string
+	// Name is the name of the field in the query
+	Name string
+	// Descending reports whether the order is descending
+	Descending bool
+}
+
+// CriteriaError is returned when the criteria reference unknown fields or
+// operators
+type CriteriaError struct {
+	Errors []FieldError
+}
+
+// Error returns the error message
+func (e *CriteriaError) Error() string {
+	messages := []string{}
+
+	for _, err := range e.Errors {
+		messages = append(messages, err.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+type criteriaField struct {
+	field     reflect.StructField
+	operators map[Operator]bool
+}
+
+type criteriaSpec struct {
+	filter map[string]*criteriaField
+	sort   map[string]*criteriaField
+}
+
+// DecodeCriteria decodes the filter and sort criteria from the query of the
+// request, e.g. ?filter[status]=active&filter[age][gte]=18&sort=-created_at.
+// The fields of the spec struct declare the allowed criteria with the filter
+// tag, which contains the name of the field followed by the allowed
+// operators, e.g. filter:"age,eq,gte,lte", and the sort tag, which contains
+// the name of the field, e.g. sort:"created_at". The eq operator is allowed
+// if none is given. It responds with 400 Bad Request if the criteria
+// reference unknown fields or operators, if a filter parameter is repeated or
+// if the operands are invalid.
+func DecodeCriteria(r *http.Request, spec interface{}) (*Criteria, error) {
+	var (
+		criteria = &Criteria{}
+		fields   = criteriaSpecOf(spec)
+		errs     = []FieldError{}
+		values   = url.Values{}
+	)
+
+	if r.URL != nil {
+		values = r.URL.Query()
+	}
+
+	report := func(key, tag, param, value, format string, args ...interface{}) {
+		errs = append(errs, FieldError{
+			Field:   key,
+			Tag:     tag,
+			Param:   param,
+			Value:   value,
+			Message: fmt.Sprintf(format, args...),
+			Source:  "query",
+		})
+	}
+
+	keys := []string{}
+
+	for key := range values {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := values.Get(key)
+
+		// the conditions of a field and an operator are not combined
+		if len(values[key]) > 1 {
+			report(key, "filter", "", value, "repeated filter parameter %q", key)
+			continue
+		}
+
+		name, operator, ok := criteriaKey(key)
+		if !ok {
+			report(key, "filter", "", value, "malformed filter parameter %q", key)
+			continue
+		}
+
+		item, ok := fields.filter[name]
+		if !ok {
+			report(key, "filter", "", value, "unknown filter field %q", name)
+			continue
+		}
+
+		if !item.operators[operator] {
+			report(key, "operator", string(operator), value, "unsupported operator %q of filter field %q", operator, name)
+			continue
+		}
+
+		operand, err := criteriaValue(item.field.Type, operator, value)
+		if err != nil {
+			report(key, "value", string(operator), value, "invalid value of filter field %q", name)
+			continue
+		}
+
+		criteria.Filter = append(criteria.Filter, Condition{
+			Field:    item.field.Name,
+			Name:     name,
+			Operator: operator,
+			Value:    operand,
+		})
+	}
+
+	for _, value := range values["sort"] {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+
+			if name == "" {
+				continue
+			}
+
+			order := Order{}
+
+			switch name[0] {
+			case '-':
+				order.Descending = true
+				name = name[1:]
+			case '+':
+				name = name[1:]
+			}
+
+			item, ok := fields.sort[name]
+			if !ok {
+				report("sort", "sort", name, value, "unknown sort field %q", name)
+				continue
+			}
+
+			order.Field = item.field.Name
+			order.Name = name
+
+			criteria.Sort = append(criteria.Sort, order)
+		}
+	}
+
+	if len(errs) > 0 {
+		err := &CriteriaError{Errors: errs}
+
+		return nil, errors.WrapSkipFrames(err, "decode", 2).
+			AddTag("status", http.StatusBadRequest).
+			AddTag(ProblemExtensionPrefix+"errors", errs)
+	}
+
+	return criteria, nil
+}
+
+// criteriaKey parses the field name and the operator of a filter key
+func criteriaKey(key string) (string, Operator, bool) {
+	segments := []string{}
+	key = strings.TrimPrefix(key, "filter")
+
+	for key != "" {
+		if key[0] != '[' {
+			return "", "", false
+		}
+
+		index := strings.IndexByte(key, ']')
+		if index <= 1 {
+			return "", "", false
+		}
+
+		segments = append(segments, key[1:index])
+		key = key[index+1:]
+	}
+
+	switch len(segments) {
+	case 1:
+		return segments[0], OperatorEq, true
+	case 2:
+		return segments[0], Operator(strings.ToLower(segments[1])), true
+	default:
+		return "", "", false
+	}
+}
+
+// criteriaValue converts the operand to the type of the field
+func criteriaValue(kind reflect.Type, operator Operator, value string) (interface{}, error) {
+	values := []string{value}
+
+	if operator == OperatorIn || operator == OperatorNin {
+		values = strings.Split(value, ",")
+		kind = reflect.SliceOf(kind)
+	}
+
+	holder := reflect.New(reflect.StructOf([]reflect.StructField{
+		{Name: "Value", Type: kind, Tag: `form:"value"`},
+	}))
+
+	if err := form.NewDecoder().Decode(holder.Interface(), url.Values{"value": values}); err != nil {
+		return nil, err
+	}
+
+	return holder.Elem().Field(0).Interface(), nil
+}
+
+// criteriaSpecOf returns the criteria allowed by the tags of the spec
+func criteriaSpecOf(spec interface{}) *criteriaSpec {
+	result := &criteriaSpec{
+		filter: make(map[string]*criteriaField),
+		sort:   make(map[string]*criteriaField),
+	}
+
+	kind := reflect.TypeOf(spec)
+
+	for kind != nil && kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+
+	if kind == nil || kind.Kind() != reflect.Struct {
+		return result
+	}
+
+	for index := 0; index < kind.NumField(); index++ {
+		field := kind.Field(index)
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if tag, ok := field.Tag.Lookup("filter"); ok && tag != "-" {
+			parts := strings.Split(tag, ",")
+
+			item := &criteriaField{
+				field:     field,
+				operators: make(map[Operator]bool),
+			}
+
+			for _, operator := range parts[1:] {
+				item.operators[Operator(strings.TrimSpace(operator))] = true
+			}
+
+			if len(item.operators) == 0 {
+				item.operators[OperatorEq] = true
+			}
+
+			result.filter[criteriaName(field, parts[0])] = item
+		}
+
+		if tag, ok := field.Tag.Lookup("sort"); ok && tag != "-" {
+			result.sort[criteriaName(field, tag)] = &criteriaField{field: field}
+		}
+	}
+
+	return result
+}
+
+func criteriaName(field reflect.StructField, name string) string {
+	if name = strings.TrimSpace(name); name != "" {
+		return name
+	}
+
+	if name = tagName(field, "json"); name != "" {
+		return name
+	}
+
+	return field.Name
+}
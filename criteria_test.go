@@ -0,0 +1,101 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-playground/errors/v5"
+	"github.com/phogolabs/rest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DecodeCriteria", func() {
+	type UserCriteria struct {
+		Status    string    `json:"status" filter:",eq,in"`
+		Age       int       `filter:"age,eq,gte,lte"`
+		Name      string    `sort:"name"`
+		CreatedAt time.Time `json:"created_at" filter:"created_at,gt" sort:""`
+	}
+
+	It("decodes the filter and the sort criteria", func() {
+		request := httptest.NewRequest("GET", "http://example.com/users?filter[status][in]=active,pending&filter[age][gte]=18&filter[created_at][gt]=2020-01-01T00:00:00Z&sort=-created_at,name", nil)
+
+		criteria, err := rest.DecodeCriteria(request, &UserCriteria{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(criteria.Filter).To(ConsistOf(
+			rest.Condition{Field: "Age", Name: "age", Operator: rest.OperatorGte, Value: 18},
+			rest.Condition{Field: "CreatedAt", Name: "created_at", Operator: rest.OperatorGt, Value: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+			rest.Condition{Field: "Status", Name: "status", Operator: rest.OperatorIn, Value: []string{"active", "pending"}},
+		))
+
+		Expect(criteria.Sort).To(Equal([]rest.Order{
+			{Field: "CreatedAt", Name: "created_at", Descending: true},
+			{Field: "Name", Name: "name"},
+		}))
+	})
+
+	It("uses the eq operator by default", func() {
+		request := httptest.NewRequest("GET", "http://example.com/users?filter[age]=21", nil)
+
+		criteria, err := rest.DecodeCriteria(request, &UserCriteria{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(criteria.Filter).To(ConsistOf(
+			rest.Condition{Field: "Age", Name: "age", Operator: rest.OperatorEq, Value: 21},
+		))
+	})
+
+	Context("when the criteria are invalid", func() {
+		It("returns an error", func() {
+			request := httptest.NewRequest("GET", "http://example.com/users?filter[password]=x&filter[age][like]=1&filter[status]&sort=email", nil)
+
+			_, err := rest.DecodeCriteria(request, &UserCriteria{})
+			Expect(err).To(HaveOccurred())
+
+			recorder := httptest.NewRecorder()
+			rest.Respond(recorder, request, err)
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+
+			problem := &rest.Problem{}
+			Expect(json.NewDecoder(recorder.Body).Decode(problem)).To(Succeed())
+			Expect(problem.Extensions).To(HaveKeyWithValue("errors", HaveLen(3)))
+			Expect(problem.Detail).To(ContainSubstring(`unknown filter field "password"`))
+			Expect(problem.Detail).To(ContainSubstring(`unsupported operator "like" of filter field "age"`))
+			Expect(problem.Detail).To(ContainSubstring(`unknown sort field "email"`))
+		})
+
+		Context("when the value cannot be converted", func() {
+			It("returns an error", func() {
+				request := httptest.NewRequest("GET", "http://example.com/users?filter[age][gte]=old", nil)
+
+				_, err := rest.DecodeCriteria(request, &UserCriteria{})
+				Expect(err).To(HaveOccurred())
+
+				var cerr *rest.CriteriaError
+				Expect(errors.As(err, &cerr)).To(BeTrue())
+				Expect(cerr.Errors).To(HaveLen(1))
+				Expect(cerr.Errors[0].Field).To(Equal("filter[age][gte]"))
+				Expect(cerr.Errors[0].Tag).To(Equal("value"))
+			})
+		})
+
+		Context("when a filter parameter is repeated", func() {
+			It("returns an error", func() {
+				request := httptest.NewRequest("GET", "http://example.com/users?filter[age][gte]=18&filter[age][gte]=21", nil)
+
+				_, err := rest.DecodeCriteria(request, &UserCriteria{})
+				Expect(err).To(HaveOccurred())
+
+				var cerr *rest.CriteriaError
+				Expect(errors.As(err, &cerr)).To(BeTrue())
+				Expect(cerr.Errors).To(HaveLen(1))
+				Expect(cerr.Errors[0].Field).To(Equal("filter[age][gte]"))
+				Expect(cerr.Errors[0].Tag).To(Equal("filter"))
+			})
+		})
+	})
+})
@@ -1,25 +1,184 @@
 package rest
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/creasty/defaults"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/go-playground/errors/v5"
 	"github.com/go-playground/form/v4"
+	"github.com/go-playground/validator/v10"
+	"github.com/phogolabs/rest/middleware"
 )
 
-// ErrNoRouteContextFound returns no route context error
-var ErrNoRouteContextFound = fmt.Errorf("no route context found")
+var (
+	// ErrNoRouteContextFound returns no route context error
+	ErrNoRouteContextFound = fmt.Errorf("no route context found")
+
+	// ErrBodyTooLarge returns request body too large error
+	ErrBodyTooLarge = fmt.Errorf("request body too large")
+)
+
+var decodeCtxKey = &middleware.ContextKey{Name: "DecodeConfig"}
+
+// DefaultMaxBytes is the size limit of the JSON bodies that are buffered to
+// find the unknown members when MaxBytes is not set
+const DefaultMaxBytes = 10 << 20
+
+// DecodeConfig represents the configuration of the request body decoding
+type DecodeConfig struct {
+	// MaxBytes limits the size of the request body
+	MaxBytes int64
+	// DisallowUnknownFields rejects the JSON objects with unknown members
+	DisallowUnknownFields bool
+	// UseNumber decodes the JSON numbers as json.Number
+	UseNumber bool
+	// MaxMemory is the number of bytes of the multipart form parts that are
+	// kept in memory
+	MaxMemory int64
+}
+
+// DecodeOption represents a decoding option
+type DecodeOption func(config *DecodeConfig)
+
+// DecodeWithMaxBytes limits the size of the request body. Decode responds with
+// 413 Request Entity Too Large if the body exceeds the limit.
+func DecodeWithMaxBytes(n int64) DecodeOption {
+	return func(config *DecodeConfig) {
+		config.MaxBytes = n
+	}
+}
+
+// DecodeWithDisallowUnknownFields rejects the JSON objects with members that
+// do not match any field of the decoded entity
+func DecodeWithDisallowUnknownFields() DecodeOption {
+	return func(config *DecodeConfig) {
+		config.DisallowUnknownFields = true
+	}
+}
+
+// DecodeWithUseNumber decodes the JSON numbers as json.Number
+func DecodeWithUseNumber() DecodeOption {
+	return func(config *DecodeConfig) {
+		config.UseNumber = true
+	}
+}
+
+// DecodeWithMaxMemory sets the number of bytes of the multipart form parts
+// that are kept in memory. The rest is stored in temporary files.
+func DecodeWithMaxMemory(n int64) DecodeOption {
+	return func(config *DecodeConfig) {
+		config.MaxMemory = n
+	}
+}
+
+// DecodeWithOption returns a middleware that configures the decoding of the
+// requests of a route. The options of nested middlewares are composed. The
+// temporary files of the multipart forms are removed after the handler returns.
+func DecodeWithOption(options ...DecodeOption) func(http.Handler) http.Handler {
+	mw := func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			config := GetDecodeConfig(r)
+
+			for _, option := range options {
+				option(&config)
+			}
+
+			if config.MaxBytes > 0 && r.Body != nil {
+				r.Body = &decodeLimitReader{
+					ReadCloser: r.Body,
+					remain:     config.MaxBytes,
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), decodeCtxKey, config)
+
+			if _, ok := ctx.Value(multipartCtxKey).(*multipartCleanup); !ok {
+				cleanup := &multipartCleanup{}
+				defer cleanup.release()
+
+				ctx = context.WithValue(ctx, multipartCtxKey, cleanup)
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return mw
+}
+
+// GetDecodeConfig returns the decoding configuration of the request
+func GetDecodeConfig(r *http.Request) DecodeConfig {
+	config, _ := r.Context().Value(decodeCtxKey).(DecodeConfig)
+	return config
+}
+
+// UnknownFieldsError is returned when the request body contains JSON members
+// that do not match any field of the decoded entity
+type UnknownFieldsError struct {
+	Fields []string
+}
+
+// Error returns the error message
+func (e *UnknownFieldsError) Error() string {
+	return fmt.Sprintf("json: unknown fields %q", e.Fields)
+}
+
+type decodeLimitReader struct {
+	io.ReadCloser
+	remain int64
+	err    error
+}
+
+// Read reads up to the limit and fails with ErrBodyTooLarge afterwards
+func (l *decodeLimitReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// one more byte is read in order to detect whether the limit is exceeded
+	if int64(len(p))-1 > l.remain {
+		p = p[:l.remain+1]
+	}
+
+	n, err := l.ReadCloser.Read(p)
+
+	if int64(n) <= l.remain {
+		l.remain -= int64(n)
+		l.err = err
+		return n, err
+	}
+
+	n = int(l.remain)
+	l.remain = 0
+	l.err = ErrBodyTooLarge
+
+	return n, l.err
+}
 
 func init() {
 	render.Decode = decode
 	render.Respond = respond
+
+	middleware.ErrorResponder = func(w http.ResponseWriter, r *http.Request, err error) {
+		Respond(w, r, err)
+	}
 }
 
 // Decode is a package-level variable set to our default Decoder. We do this
@@ -36,8 +195,13 @@ func Decode(r *http.Request, v interface{}) error {
 	return Validate(r, v)
 }
 
-// DecodeForm decodes an entity from form fields
+// DecodeForm decodes an entity from form fields. The multipart forms are
+// decoded by DecodeMultipartForm.
 func DecodeForm(r *http.Request, v interface{}) (err error) {
+	if codecKey(r.Header.Get("Content-Type")) == "multipart/form-data" {
+		return DecodeMultipartForm(r, v)
+	}
+
 	decoder := form.NewDecoder()
 
 	if err = r.ParseForm(); err == nil {
@@ -107,14 +271,171 @@ func DecodeHeader(r *http.Request, v interface{}) error {
 	return decoder.Decode(v, values)
 }
 
+// DecodeRequest decodes an entity from the request body, path, query and
+// header in one call. The fields are populated from the body first and then
+// from the path, query and header according to their tags. Only the fields
+// with a path, query or header tag are populated from these sources, so the
+// body fields cannot be overwritten by the query or the headers. The defaults are
+// set and the entity is validated once all sources are decoded. The errors
+// report the source of the invalid fields.
+func DecodeRequest(r *http.Request, v interface{}) error {
+	errf := func(errno error, source string) error {
+		return errors.WrapSkipFrames(errno, "decode", 2).
+			AddTag("status", http.StatusBadRequest).
+			AddTag(ProblemExtensionPrefix+"source", source)
+	}
+
+	if r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+		if err := render.Decode(r, v); err != nil {
+			if _, ok := errors.LookupTag(err, "status").(int); !ok {
+				return errf(err, "body")
+			}
+
+			return errors.Wrap(err, "decode").AddTag(ProblemExtensionPrefix+"source", "body")
+		}
+	}
+
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		values := url.Values{}
+
+		for index, key := range rctx.URLParams.Keys {
+			values.Add(key, rctx.URLParams.Values[index])
+		}
+
+		if err := decodeTagged("path").Decode(v, values); err != nil {
+			return errf(err, "path")
+		}
+	}
+
+	if r.URL != nil {
+		if err := decodeTagged("query").Decode(v, r.URL.Query()); err != nil {
+			return errf(err, "query")
+		}
+	}
+
+	if err := decodeTagged("header").Decode(v, url.Values(r.Header)); err != nil {
+		return errf(err, "header")
+	}
+
+	if err := defaults.Set(v); err != nil {
+		return errf(err, "body")
+	}
+
+	if err := ValidateRequest(r, v); err != nil {
+		return errors.Wrap(err, "decode").AddTag("sources", decodeSources(v, err))
+	}
+
+	return nil
+}
+
+// decodeTagged returns a form decoder that populates only the fields with the
+// given tag. The embedded structs are traversed.
+func decodeTagged(tag string) *form.Decoder {
+	decoder := form.NewDecoder()
+	decoder.SetTagName(tag)
+	decoder.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := field.Tag.Get(tag)
+
+		if name == "" && !field.Anonymous {
+			return "-"
+		}
+
+		return name
+	})
+
+	return decoder
+}
+
+// decodeSources returns the sources of the invalid fields of the entity
+func decodeSources(v interface{}, err error) map[string]string {
+	var (
+		verrs   validator.ValidationErrors
+		sources = make(map[string]string)
+	)
+
+	if errors.As(err, &verrs) {
+		for _, verr := range verrs {
+			field := fieldPath(verr.Namespace(), verr.Field())
+			sources[field] = decodeSource(v, verr.StructNamespace())
+		}
+	}
+
+	return sources
+}
+
+// decodeSource returns the source of a field of the entity decoded by
+// DecodeRequest
+func decodeSource(v interface{}, namespace string) string {
+	kind := reflect.TypeOf(v)
+
+	for kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+
+	if kind.Kind() != reflect.Struct {
+		return "body"
+	}
+
+	// the root element is the name of the validated struct
+	parts := strings.Split(namespace, ".")
+	if len(parts) < 2 {
+		return "body"
+	}
+
+	name := parts[1]
+	// the collection elements are suffixed with their index
+	if index := strings.Index(name, "["); index != -1 {
+		name = name[:index]
+	}
+
+	if field, ok := kind.FieldByName(name); ok {
+		for _, source := range []string{"path", "query", "header"} {
+			name := strings.Split(field.Tag.Get(source), ",")[0]
+
+			// the fields tagged with - are not bound to the source
+			if name != "" && name != "-" {
+				return source
+			}
+		}
+	}
+
+	return "body"
+}
+
 func decode(r *http.Request, v interface{}) (err error) {
 	errf := func(errno error) error {
-		return errors.WrapSkipFrames(errno, "decode", 3).AddTag("status", http.StatusBadRequest)
+		status := http.StatusBadRequest
+
+		if errors.Is(errno, ErrBodyTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		ch := errors.WrapSkipFrames(errno, "decode", 3).AddTag("status", status)
+
+		var uerr *UnknownFieldsError
+
+		if errors.As(errno, &uerr) {
+			ch = ch.AddTag(ProblemExtensionPrefix+"unknown_fields", uerr.Fields)
+		}
+
+		return ch
+	}
+
+	if codec, ok := codecRequest(r); ok {
+		if err = codec.Decode(r.Body, v); err != nil && err != io.EOF {
+			return errf(err)
+		}
+
+		if err = defaults.Set(v); err != nil {
+			return errf(err)
+		}
+
+		return nil
 	}
 
-	switch render.GetRequestContentType(r) {
+	switch requestContentType(r) {
 	case render.ContentTypeJSON:
-		err = render.DecodeJSON(r.Body, v)
+		err = decodeJSON(r.Body, v, GetDecodeConfig(r))
 	case render.ContentTypeXML:
 		err = render.DecodeXML(r.Body, v)
 	case render.ContentTypeForm:
@@ -134,8 +455,232 @@ func decode(r *http.Request, v interface{}) (err error) {
 	return nil
 }
 
+// requestContentType returns the content type of the request. The multipart
+// forms are handled as forms.
+func requestContentType(r *http.Request) render.ContentType {
+	kind := render.GetRequestContentType(r)
+
+	if kind == render.ContentTypeUnknown && codecKey(r.Header.Get("Content-Type")) == "multipart/form-data" {
+		return render.ContentTypeForm
+	}
+
+	return kind
+}
+
+// decodeJSON decodes a single JSON value from the reader. The body is
+// buffered only when the unknown members are rejected.
+func decodeJSON(r io.Reader, v interface{}, config DecodeConfig) error {
+	if config.DisallowUnknownFields {
+		limit := config.MaxBytes
+
+		if limit <= 0 {
+			limit = DefaultMaxBytes
+		}
+
+		data, err := io.ReadAll(io.LimitReader(r, limit+1))
+		if err != nil {
+			return err
+		}
+
+		if int64(len(data)) > limit {
+			return ErrBodyTooLarge
+		}
+
+		if len(bytes.TrimSpace(data)) == 0 {
+			return io.EOF
+		}
+
+		if fields := decodeUnknownFields(data, reflect.TypeOf(v), ""); len(fields) > 0 {
+			return &UnknownFieldsError{Fields: fields}
+		}
+
+		r = bytes.NewReader(data)
+	}
+
+	decoder := json.NewDecoder(r)
+
+	if config.UseNumber {
+		decoder.UseNumber()
+	}
+
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		// the limit is exceeded after the top-level value
+		if errors.Is(err, ErrBodyTooLarge) {
+			return err
+		}
+
+		return fmt.Errorf("json: unexpected data after top-level value")
+	}
+
+	return nil
+}
+
+// decodeUnknownFields returns the paths of the JSON object members that do not
+// have a corresponding field in the given type
+func decodeUnknownFields(data []byte, kind reflect.Type, prefix string) []string {
+	for kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+
+	// the type decodes itself
+	if reflect.PtrTo(kind).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) {
+		return nil
+	}
+
+	fields := []string{}
+
+	switch kind.Kind() {
+	case reflect.Struct:
+		members := make(map[string]json.RawMessage)
+
+		if err := json.Unmarshal(data, &members); err != nil {
+			return nil
+		}
+
+		names := decodeFieldNames(kind)
+
+		keys := make([]string, 0, len(members))
+
+		for key := range members {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			field, ok := decodeFieldLookup(names, key)
+
+			if !ok {
+				fields = append(fields, prefix+key)
+				continue
+			}
+
+			fields = append(fields, decodeUnknownFields(members[key], field.Type, prefix+key+".")...)
+		}
+	case reflect.Slice, reflect.Array:
+		items := []json.RawMessage{}
+
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil
+		}
+
+		path := strings.TrimSuffix(prefix, ".")
+
+		for index, item := range items {
+			fields = append(fields, decodeUnknownFields(item, kind.Elem(), fmt.Sprintf("%s[%d].", path, index))...)
+		}
+	case reflect.Map:
+		members := make(map[string]json.RawMessage)
+
+		if err := json.Unmarshal(data, &members); err != nil {
+			return nil
+		}
+
+		for key, item := range members {
+			fields = append(fields, decodeUnknownFields(item, kind.Elem(), prefix+key+".")...)
+		}
+
+		sort.Strings(fields)
+	}
+
+	return fields
+}
+
+// decodeField represents a struct field and its JSON name
+type decodeField struct {
+	Name  string
+	Field reflect.StructField
+}
+
+// decodeFieldLookup returns the field of the given JSON name. As encoding/json
+// does, the exact match is preferred to the first case-insensitive match in
+// declaration order.
+func decodeFieldLookup(fields []decodeField, name string) (reflect.StructField, bool) {
+	for _, field := range fields {
+		if field.Name == name {
+			return field.Field, true
+		}
+	}
+
+	for _, field := range fields {
+		if strings.EqualFold(field.Name, name) {
+			return field.Field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// decodeFieldNames returns the JSON names of the struct fields including the
+// fields of the embedded structs in declaration order
+func decodeFieldNames(kind reflect.Type) []decodeField {
+	var (
+		fields  = []decodeField{}
+		indexes = make(map[string]int)
+		direct  = make(map[string]bool)
+	)
+
+	add := func(name string, field reflect.StructField, embedded bool) {
+		index, ok := indexes[name]
+
+		switch {
+		case !ok:
+			indexes[name] = len(fields)
+			fields = append(fields, decodeField{Name: name, Field: field})
+		case !embedded && !direct[name]:
+			// the fields of the outer struct take precedence
+			fields[index].Field = field
+		default:
+			return
+		}
+
+		direct[name] = direct[name] || !embedded
+	}
+
+	for index := 0; index < kind.NumField(); index++ {
+		field := kind.Field(index)
+		name := tagName(field, "json")
+
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+
+			if embedded.Kind() == reflect.Struct {
+				for _, item := range decodeFieldNames(embedded) {
+					add(item.Name, item.Field, true)
+				}
+
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		add(name, field, false)
+	}
+
+	return fields
+}
+
 func respond(w http.ResponseWriter, r *http.Request, v interface{}) {
-	render.DefaultResponder(w, r, v)
+	negotiateRespond(w, r, v)
 
 	if err := defaults.Set(v); err != nil {
 		GetLogger(r).WithError(err).Errorf("unable to set defaults")
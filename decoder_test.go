@@ -1,12 +1,16 @@
 package rest_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-playground/errors"
+	"github.com/go-playground/errors/v5"
 	"github.com/phogolabs/rest"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -62,6 +66,19 @@ var _ = Describe("Decode", func() {
 				err = errors.Cause(err)
 				Expect(err).To(MatchError("Key: 'Contact.phone' Error:Field validation for 'phone' failed on the 'phone' tag"))
 			})
+
+			It("returns the field errors", func() {
+				entity := Contact{}
+
+				err := rest.Decode(request, &entity)
+				Expect(err).To(HaveOccurred())
+
+				errs := rest.FieldErrors(err)
+				Expect(errs).To(HaveLen(1))
+				Expect(errs[0].Field).To(Equal("phone"))
+				Expect(errs[0].Tag).To(Equal("phone"))
+				Expect(errs[0].Value).To(Equal("088HIPPO"))
+			})
 		})
 	})
 
@@ -197,3 +214,319 @@ var _ = Describe("DecodeHeader", func() {
 		})
 	})
 })
+
+var _ = Describe("DecodeRequest", func() {
+	type User struct {
+		ID    int    `path:"id" validate:"gte=1"`
+		Page  int    `query:"page" default:"1" validate:"lte=10"`
+		Token string `header:"X-Token" validate:"required"`
+		Name  string `json:"name" validate:"required"`
+	}
+
+	var (
+		request  *http.Request
+		recorder *httptest.ResponseRecorder
+		handler  http.HandlerFunc
+	)
+
+	serve := func() {
+		router := chi.NewMux()
+		router.Post("/users/{id}", handler)
+		router.ServeHTTP(recorder, request)
+	}
+
+	respond := func(w http.ResponseWriter, r *http.Request) {
+		user := User{}
+
+		if err := rest.DecodeRequest(r, &user); err != nil {
+			rest.Respond(w, r, err)
+			return
+		}
+
+		rest.Respond(w, r, &user)
+	}
+
+	BeforeEach(func() {
+		request = NewJSONRequest(&User{Name: "Jack"})
+		request.URL.Path = "/users/1"
+		request.Header.Set("X-Token", "secret")
+
+		recorder = httptest.NewRecorder()
+		handler = respond
+	})
+
+	It("decodes the request successfully", func() {
+		request.URL.RawQuery = "page=2"
+
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			user := User{}
+			Expect(rest.DecodeRequest(r, &user)).To(Succeed())
+			Expect(user.ID).To(Equal(1))
+			Expect(user.Page).To(Equal(2))
+			Expect(user.Token).To(Equal("secret"))
+			Expect(user.Name).To(Equal("Jack"))
+		}
+
+		serve()
+	})
+
+	It("sets the defaults", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			user := User{}
+			Expect(rest.DecodeRequest(r, &user)).To(Succeed())
+			Expect(user.Page).To(Equal(1))
+		}
+
+		serve()
+	})
+
+	Context("when the query has the name of a body field", func() {
+		It("does not overwrite the body field", func() {
+			request.URL.RawQuery = "Name=admin"
+			request.Header.Set("Name", "admin")
+
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				user := User{}
+				Expect(rest.DecodeRequest(r, &user)).To(Succeed())
+				Expect(user.Name).To(Equal("Jack"))
+			}
+
+			serve()
+		})
+	})
+
+	Context("when a field is not bound to the query", func() {
+		It("reports the body as the source", func() {
+			type Account struct {
+				Role string `json:"role" query:"-" validate:"oneof=user"`
+			}
+
+			request = httptest.NewRequest("POST", "/accounts?Role=user&role=user", strings.NewReader(`{"role":"admin"}`))
+			request.Header.Set("Content-Type", "application/json")
+
+			account := &Account{}
+			err := rest.DecodeRequest(request, account)
+			Expect(err).To(HaveOccurred())
+			Expect(account.Role).To(Equal("admin"))
+
+			rest.Respond(recorder, request, err)
+
+			problem := &rest.Problem{}
+			Expect(json.NewDecoder(recorder.Body).Decode(problem)).To(Succeed())
+			Expect(problem.Extensions).To(HaveKeyWithValue("errors", ConsistOf(
+				HaveKeyWithValue("source", "body"),
+			)))
+		})
+	})
+
+	Context("when the query cannot be decoded", func() {
+		BeforeEach(func() {
+			request.URL.RawQuery = "page=root"
+		})
+
+		It("responds with the source", func() {
+			serve()
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+
+			problem := &rest.Problem{}
+			Expect(json.NewDecoder(recorder.Body).Decode(problem)).To(Succeed())
+			Expect(problem.Extensions).To(HaveKeyWithValue("source", "query"))
+		})
+	})
+
+	Context("when the validation fails", func() {
+		BeforeEach(func() {
+			request.URL.RawQuery = "page=20"
+			request.Header.Del("X-Token")
+		})
+
+		It("responds with the source of the fields", func() {
+			serve()
+
+			Expect(recorder.Code).To(Equal(http.StatusUnprocessableEntity))
+
+			problem := &rest.Problem{}
+			Expect(json.NewDecoder(recorder.Body).Decode(problem)).To(Succeed())
+			Expect(problem.Extensions).To(HaveKeyWithValue("errors", ConsistOf(
+				SatisfyAll(
+					HaveKeyWithValue("field", "page"),
+					HaveKeyWithValue("source", "query"),
+				),
+				SatisfyAll(
+					HaveKeyWithValue("field", "X-Token"),
+					HaveKeyWithValue("source", "header"),
+				),
+			)))
+		})
+	})
+})
+
+var _ = Describe("DecodeWithOption", func() {
+	type Address struct {
+		City string `json:"city"`
+	}
+
+	type User struct {
+		Name    string   `json:"name"`
+		Address *Address `json:"address"`
+	}
+
+	var (
+		request  *http.Request
+		recorder *httptest.ResponseRecorder
+		options  []rest.DecodeOption
+		entity   interface{}
+	)
+
+	serve := func() {
+		router := chi.NewMux()
+		router.Use(rest.DecodeWithOption(options...))
+		router.Post("/", func(w http.ResponseWriter, r *http.Request) {
+			if err := rest.Decode(r, entity); err != nil {
+				rest.Respond(w, r, err)
+				return
+			}
+
+			rest.Respond(w, r, entity)
+		})
+
+		router.ServeHTTP(recorder, request)
+	}
+
+	BeforeEach(func() {
+		options = []rest.DecodeOption{}
+		entity = &User{}
+		recorder = httptest.NewRecorder()
+		request = NewJSONRequest(map[string]interface{}{
+			"name":  "Jack",
+			"email": "jack@example.com",
+			"address": map[string]interface{}{
+				"city": "London",
+				"zip":  "E1 6AN",
+			},
+		})
+	})
+
+	It("ignores the unknown fields", func() {
+		serve()
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+	})
+
+	Context("when the body exceeds the limit", func() {
+		BeforeEach(func() {
+			options = append(options, rest.DecodeWithMaxBytes(10))
+		})
+
+		It("responds with 413", func() {
+			serve()
+
+			Expect(recorder.Code).To(Equal(http.StatusRequestEntityTooLarge))
+
+			problem := &rest.Problem{}
+			Expect(json.NewDecoder(recorder.Body).Decode(problem)).To(Succeed())
+			Expect(problem.Status).To(Equal(http.StatusRequestEntityTooLarge))
+		})
+	})
+
+	Context("when the unknown fields are disallowed", func() {
+		BeforeEach(func() {
+			options = append(options, rest.DecodeWithDisallowUnknownFields())
+		})
+
+		It("responds with the unknown fields", func() {
+			serve()
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+
+			problem := &rest.Problem{}
+			Expect(json.NewDecoder(recorder.Body).Decode(problem)).To(Succeed())
+			Expect(problem.Extensions).To(HaveKeyWithValue("unknown_fields", ConsistOf("address.zip", "email")))
+		})
+
+		Context("when the names match case-insensitively", func() {
+			BeforeEach(func() {
+				entity = &struct {
+					Home *Address `json:"home"`
+					HOME string   `json:"HOME"`
+				}{}
+
+				request = NewJSONRequest(map[string]interface{}{
+					"Home": map[string]interface{}{
+						"city": "London",
+						"zip":  "E1 6AN",
+					},
+				})
+			})
+
+			It("matches the first field in declaration order", func() {
+				for index := 0; index < 10; index++ {
+					recorder = httptest.NewRecorder()
+					request.Body = io.NopCloser(strings.NewReader(`{"Home":{"city":"London","zip":"E1 6AN"}}`))
+					serve()
+
+					problem := &rest.Problem{}
+					Expect(json.NewDecoder(recorder.Body).Decode(problem)).To(Succeed())
+					Expect(problem.Extensions).To(HaveKeyWithValue("unknown_fields", ConsistOf("Home.zip")))
+				}
+			})
+		})
+
+		Context("when the body exceeds the default limit", func() {
+			BeforeEach(func() {
+				body := fmt.Sprintf(`{"name":"%s"}`, strings.Repeat("a", rest.DefaultMaxBytes))
+				request = httptest.NewRequest("POST", "http://example.com", strings.NewReader(body))
+				request.Header.Set("Content-Type", "application/json")
+			})
+
+			It("responds with 413", func() {
+				serve()
+				Expect(recorder.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			})
+		})
+	})
+
+	Context("when the numbers are decoded as json.Number", func() {
+		BeforeEach(func() {
+			options = append(options, rest.DecodeWithUseNumber())
+			request = NewJSONRequest(map[string]interface{}{"age": 22})
+		})
+
+		It("decodes the number", func() {
+			person := &struct {
+				Age interface{} `json:"age"`
+			}{}
+
+			entity = person
+			serve()
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(person.Age).To(Equal(json.Number("22")))
+		})
+	})
+
+	Context("when the body exceeds the limit after the value", func() {
+		BeforeEach(func() {
+			options = append(options, rest.DecodeWithMaxBytes(32))
+			request = httptest.NewRequest("POST", "http://example.com", strings.NewReader(`{"name":"Jack"}`+strings.Repeat(" ", 64)))
+			request.Header.Set("Content-Type", "application/json")
+		})
+
+		It("responds with 413", func() {
+			serve()
+			Expect(recorder.Code).To(Equal(http.StatusRequestEntityTooLarge))
+		})
+	})
+
+	Context("when the body has trailing data", func() {
+		BeforeEach(func() {
+			request = httptest.NewRequest("POST", "http://example.com", strings.NewReader(`{"name":"Jack"} {"name":"John"}`))
+			request.Header.Set("Content-Type", "application/json")
+		})
+
+		It("responds with 400", func() {
+			serve()
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
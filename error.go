@@ -1,35 +1,47 @@
 package rest
 
 import (
+	stderrors "errors"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/render"
-	"github.com/go-playground/errors"
+	errorsv3 "github.com/go-playground/errors"
+	"github.com/go-playground/errors/v5"
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
-	"github.com/goware/errorx"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/phogolabs/log"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func errorf(r *http.Request, err error) error {
+func errorf(r *http.Request, err error) *Problem {
 	err = errorChain(r, err)
 
 	errorReport(r, err)
+	errorTrace(r, err)
 	errorStatus(r, err)
 
-	return errorWrap(err)
+	return errorWrap(err, GetTranslator(r))
 }
 
 func errorChain(r *http.Request, err error) error {
 	ch, ok := err.(errors.Chain)
 
 	if !ok {
-		ch = errors.WrapSkipFrames(err, "request", 4)
+		ch = errorLegacy(err)
 	}
 
 	if code, ok := errors.LookupTag(ch, "status").(int); !ok {
 		if code, ok = r.Context().Value(render.StatusCtxKey).(int); !ok {
 			code = http.StatusInternalServerError
+
+			var problem *Problem
+			// the problem carries its own status
+			if errors.As(ch, &problem) && problem.Status != 0 {
+				code = problem.Status
+			}
 		}
 
 		ch = ch.AddTag("status", code)
@@ -38,6 +50,33 @@ func errorChain(r *http.Request, err error) error {
 	return ch
 }
 
+// errorLegacy wraps the error in a chain. The tags of the chains created by
+// the v3 errors package are kept, so their status is honoured.
+func errorLegacy(err error) errors.Chain {
+	legacy, ok := err.(errorsv3.Chain)
+
+	if !ok {
+		return errors.WrapSkipFrames(err, "request", 5)
+	}
+
+	var (
+		ch   = errors.WrapSkipFrames(errorsv3.Cause(legacy), "request", 5)
+		keys = map[string]bool{}
+	)
+
+	// the most recent tags take precedence
+	for index := len(legacy) - 1; index >= 0; index-- {
+		for _, tag := range legacy[index].Tags {
+			if !keys[tag.Key] {
+				keys[tag.Key] = true
+				ch = ch.AddTag(tag.Key, tag.Value)
+			}
+		}
+	}
+
+	return ch
+}
+
 func errorReport(r *http.Request, err error) {
 	status := errors.LookupTag(err, "status").(int)
 
@@ -59,28 +98,136 @@ func errorReport(r *http.Request, err error) {
 	}
 }
 
+// errorTrace records the error on the span started by the Tracing middleware
+func errorTrace(r *http.Request, err error) {
+	span := trace.SpanFromContext(r.Context())
+
+	if !span.IsRecording() {
+		return
+	}
+
+	status := errors.LookupTag(err, "status").(int)
+
+	span.RecordError(err, trace.WithAttributes(semconv.HTTPStatusCodeKey.Int(status)))
+}
+
 func errorStatus(r *http.Request, err error) {
 	status := errors.LookupTag(err, "status").(int)
 	Status(r, status)
 }
 
-func errorWrap(err error) *errorx.Errorx {
+func errorWrap(err error, trans ut.Translator) *Problem {
 	code := errors.LookupTag(err, "status").(int)
-	errx := errorx.New(code, http.StatusText(code))
-	err = errors.Cause(err)
 
-	if errs, ok := err.(*multierror.Error); ok {
-		for _, err := range errs.Errors {
-			errx.Details = append(errx.Details, err.Error())
+	problem := &Problem{
+		Type:   "about:blank",
+		Title:  translationTitle(trans, code),
+		Status: code,
+	}
+
+	var (
+		perr  *Problem
+		merr  *multierror.Error
+		verrs validator.ValidationErrors
+	)
+
+	switch {
+	case errors.As(err, &perr):
+		problem.Type = errorValue(perr.Type, problem.Type)
+		problem.Title = errorValue(perr.Title, problem.Title)
+		problem.Detail = perr.Detail
+		problem.Instance = perr.Instance
+
+		for key, value := range perr.Extensions {
+			errorExtend(problem, key, value)
+		}
+	case errors.As(err, &merr):
+		details := []string{}
+
+		for _, err := range merr.Errors {
+			details = append(details, err.Error())
+		}
+
+		problem.Detail = strings.Join(details, "; ")
+		errorExtend(problem, "details", details)
+	case errors.As(err, &verrs):
+		var (
+			errs    = TranslateFieldErrors(err, trans)
+			details = []string{}
+		)
+
+		for _, ferr := range errs {
+			details = append(details, ferr.Message)
 		}
-	} else if verrs, ok := err.(validator.ValidationErrors); ok {
-		for _, verr := range verrs {
-			if ferr, ok := verr.(error); ok {
-				errx.Details = append(errx.Details, ferr.Error())
+
+		problem.Detail = strings.Join(details, "; ")
+		errorExtend(problem, "errors", errs)
+	default:
+		problem.Detail = errors.Cause(err).Error()
+	}
+
+	if value, ok := errors.LookupTag(err, "type").(string); ok {
+		problem.Type = value
+	}
+
+	if value, ok := errors.LookupTag(err, "title").(string); ok {
+		problem.Title = value
+	}
+
+	if value, ok := errors.LookupTag(err, "detail").(string); ok {
+		problem.Detail = value
+	}
+
+	if value, ok := errors.LookupTag(err, "instance").(string); ok {
+		problem.Instance = value
+	}
+
+	errorTags(err, func(tag errors.Tag) {
+		if key := strings.TrimPrefix(tag.Key, ProblemExtensionPrefix); key != tag.Key {
+			errorExtend(problem, key, tag.Value)
+		}
+	})
+
+	return problem
+}
+
+// errorTags visits the tags of the chain from the root cause to the most
+// recent link, so the later tags take precedence.
+func errorTags(err error, fn func(tag errors.Tag)) {
+	var chains []errors.Chain
+
+	for err != nil {
+		ch, ok := err.(errors.Chain)
+		if !ok {
+			err = stderrors.Unwrap(err)
+			continue
+		}
+
+		chains = append(chains, ch)
+		err = ch[0].Err
+	}
+
+	for index := len(chains) - 1; index >= 0; index-- {
+		for _, link := range chains[index] {
+			for _, tag := range link.Tags {
+				fn(tag)
 			}
 		}
-	} else {
-		errx.Details = append(errx.Details, err.Error())
 	}
-	return errx
+}
+
+func errorExtend(problem *Problem, key string, value interface{}) {
+	if problem.Extensions == nil {
+		problem.Extensions = make(map[string]interface{})
+	}
+
+	problem.Extensions[key] = value
+}
+
+func errorValue(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
 }
@@ -8,11 +8,15 @@ import (
 	"net/http/httptest"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-playground/errors"
+	errorsv3 "github.com/go-playground/errors"
+	"github.com/go-playground/errors/v5"
 	"github.com/go-playground/validator/v10"
-	"github.com/goware/errorx"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/phogolabs/rest"
+	"github.com/phogolabs/rest/middleware"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -24,6 +28,7 @@ var _ = Describe("Error", func() {
 		request  *http.Request
 		handle   handlerFn
 		decode   decodeFn
+		kind     string
 	)
 
 	ItHandlesTheError := func() {
@@ -32,14 +37,85 @@ var _ = Describe("Error", func() {
 				handle(recorder, request, fmt.Errorf("oh no!"))
 
 				Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+				Expect(recorder.Header().Get("Content-Type")).To(Equal(kind))
 
-				err := &errorx.Errorx{}
+				err := &rest.Problem{}
 				Expect(decode(err)).To(Succeed())
 
-				Expect(err.Code).To(Equal(http.StatusInternalServerError))
-				Expect(err.Message).To(Equal(http.StatusText(http.StatusInternalServerError)))
-				Expect(err.Details).To(HaveLen(1))
-				Expect(err.Details).To(ContainElement("oh no!"))
+				Expect(err.Type).To(Equal("about:blank"))
+				Expect(err.Status).To(Equal(http.StatusInternalServerError))
+				Expect(err.Title).To(Equal(http.StatusText(http.StatusInternalServerError)))
+				Expect(err.Detail).To(Equal("oh no!"))
+				Expect(err.Instance).To(BeEmpty())
+			})
+		})
+
+		Context("when the error has problem tags", func() {
+			It("responds with error", func() {
+				rerr := errors.New("oh no!").
+					AddTag("status", http.StatusForbidden).
+					AddTag("type", "https://example.com/probs/out-of-credit").
+					AddTag("title", "You do not have enough credit.").
+					AddTag("detail", "Your current balance is 30, but that costs 50.").
+					AddTag("instance", "/account/12345/msgs/abc").
+					AddTag(rest.ProblemExtensionPrefix+"currency", "EUR").
+					AddTag(rest.ProblemExtensionPrefix+"accounts", []string{"/account/12345", "/account/67890"})
+
+				handle(recorder, request, rerr)
+
+				Expect(recorder.Code).To(Equal(http.StatusForbidden))
+
+				err := &rest.Problem{}
+				Expect(decode(err)).To(Succeed())
+
+				Expect(err.Type).To(Equal("https://example.com/probs/out-of-credit"))
+				Expect(err.Status).To(Equal(http.StatusForbidden))
+				Expect(err.Title).To(Equal("You do not have enough credit."))
+				Expect(err.Detail).To(Equal("Your current balance is 30, but that costs 50."))
+				Expect(err.Instance).To(Equal("/account/12345/msgs/abc"))
+				Expect(err.Extensions).To(HaveKeyWithValue("currency", "EUR"))
+				Expect(err.Extensions).To(HaveKeyWithValue("accounts", ConsistOf("/account/12345", "/account/67890")))
+			})
+		})
+
+		Context("when the error is created by the v3 errors package", func() {
+			It("responds with the status of the tags", func() {
+				rerr := errorsv3.New("oh no!").
+					AddTag("status", http.StatusBadRequest).
+					AddTag(rest.ProblemExtensionPrefix+"currency", "USD")
+
+				rerr = rerr.Wrap("charge").
+					AddTag("status", http.StatusForbidden)
+
+				handle(recorder, request, rerr)
+
+				Expect(recorder.Code).To(Equal(http.StatusForbidden))
+
+				err := &rest.Problem{}
+				Expect(decode(err)).To(Succeed())
+
+				Expect(err.Status).To(Equal(http.StatusForbidden))
+				Expect(err.Detail).To(Equal("oh no!"))
+				Expect(err.Extensions).To(HaveKeyWithValue("currency", "USD"))
+			})
+		})
+
+		Context("when the error is a problem", func() {
+			It("responds with error", func() {
+				handle(recorder, request, &rest.Problem{
+					Status: http.StatusConflict,
+					Title:  "Conflict occurred",
+					Detail: "oh no!",
+				})
+
+				Expect(recorder.Code).To(Equal(http.StatusConflict))
+
+				err := &rest.Problem{}
+				Expect(decode(err)).To(Succeed())
+
+				Expect(err.Status).To(Equal(http.StatusConflict))
+				Expect(err.Title).To(Equal("Conflict occurred"))
+				Expect(err.Detail).To(Equal("oh no!"))
 			})
 		})
 
@@ -67,13 +143,12 @@ var _ = Describe("Error", func() {
 
 				Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
 
-				err := &errorx.Errorx{}
+				err := &rest.Problem{}
 				Expect(decode(err)).To(Succeed())
 
-				Expect(err.Code).To(Equal(http.StatusUnauthorized))
-				Expect(err.Message).To(Equal(http.StatusText(http.StatusUnauthorized)))
-				Expect(err.Details).To(HaveLen(1))
-				Expect(err.Details).To(ContainElement("oh no!"))
+				Expect(err.Status).To(Equal(http.StatusUnauthorized))
+				Expect(err.Title).To(Equal(http.StatusText(http.StatusUnauthorized)))
+				Expect(err.Detail).To(Equal("oh no!"))
 			})
 		})
 
@@ -84,13 +159,12 @@ var _ = Describe("Error", func() {
 
 				Expect(recorder.Code).To(Equal(http.StatusForbidden))
 
-				err := &errorx.Errorx{}
+				err := &rest.Problem{}
 				Expect(decode(err)).To(Succeed())
 
-				Expect(err.Code).To(Equal(http.StatusForbidden))
-				Expect(err.Message).To(Equal(http.StatusText(http.StatusForbidden)))
-				Expect(err.Details).To(HaveLen(1))
-				Expect(err.Details).To(ContainElement("oh no!"))
+				Expect(err.Status).To(Equal(http.StatusForbidden))
+				Expect(err.Title).To(Equal(http.StatusText(http.StatusForbidden)))
+				Expect(err.Detail).To(Equal("oh no!"))
 			})
 		})
 
@@ -101,13 +175,12 @@ var _ = Describe("Error", func() {
 
 				Expect(recorder.Code).To(Equal(http.StatusRequestTimeout))
 
-				err := &errorx.Errorx{}
+				err := &rest.Problem{}
 				Expect(decode(err)).To(Succeed())
 
-				Expect(err.Code).To(Equal(http.StatusRequestTimeout))
-				Expect(err.Message).To(Equal(http.StatusText(http.StatusRequestTimeout)))
-				Expect(err.Details).To(HaveLen(1))
-				Expect(err.Details).To(ContainElement("oh no!"))
+				Expect(err.Status).To(Equal(http.StatusRequestTimeout))
+				Expect(err.Title).To(Equal(http.StatusText(http.StatusRequestTimeout)))
+				Expect(err.Detail).To(Equal("oh no!"))
 			})
 		})
 
@@ -122,14 +195,13 @@ var _ = Describe("Error", func() {
 
 				Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
 
-				err := &errorx.Errorx{}
+				err := &rest.Problem{}
 				Expect(decode(err)).To(Succeed())
 
-				Expect(err.Code).To(Equal(http.StatusInternalServerError))
-				Expect(err.Message).To(Equal(http.StatusText(http.StatusInternalServerError)))
-				Expect(err.Details).To(HaveLen(2))
-				Expect(err.Details).To(ContainElement("oh no!"))
-				Expect(err.Details).To(ContainElement("oh yes!"))
+				Expect(err.Status).To(Equal(http.StatusInternalServerError))
+				Expect(err.Title).To(Equal(http.StatusText(http.StatusInternalServerError)))
+				Expect(err.Detail).To(Equal("oh no!; oh yes!"))
+				Expect(err.Extensions).To(HaveKeyWithValue("details", ConsistOf("oh no!", "oh yes!")))
 			})
 		})
 
@@ -144,13 +216,21 @@ var _ = Describe("Error", func() {
 
 				Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
 
-				err := &errorx.Errorx{}
+				err := &rest.Problem{}
 				Expect(decode(err)).To(Succeed())
 
-				Expect(err.Code).To(Equal(http.StatusInternalServerError))
-				Expect(err.Message).To(Equal(http.StatusText(http.StatusInternalServerError)))
-				Expect(err.Details).To(HaveLen(1))
-				Expect(err.Details).To(ContainElement(verr.Error()))
+				Expect(err.Status).To(Equal(http.StatusInternalServerError))
+				Expect(err.Title).To(Equal(http.StatusText(http.StatusInternalServerError)))
+				Expect(err.Detail).To(Equal(verr.Error()))
+				Expect(err.Extensions).To(HaveKeyWithValue("errors", ConsistOf(
+					SatisfyAll(
+						HaveKeyWithValue("field", "Age"),
+						HaveKeyWithValue("tag", "gte"),
+						HaveKeyWithValue("param", "21"),
+						HaveKeyWithValue("message", verr.Error()),
+						HaveKey("value"),
+					),
+				)))
 			})
 		})
 	}
@@ -161,6 +241,7 @@ var _ = Describe("Error", func() {
 			recorder = httptest.NewRecorder()
 			decode = json.NewDecoder(recorder.Body).Decode
 			handle = rest.Error
+			kind = "application/problem+json; charset=utf-8"
 		})
 
 		ItHandlesTheError()
@@ -172,6 +253,7 @@ var _ = Describe("Error", func() {
 			recorder = httptest.NewRecorder()
 			decode = json.NewDecoder(recorder.Body).Decode
 			handle = rest.ErrorJSON
+			kind = "application/problem+json; charset=utf-8"
 		})
 
 		ItHandlesTheError()
@@ -183,8 +265,96 @@ var _ = Describe("Error", func() {
 			recorder = httptest.NewRecorder()
 			decode = xml.NewDecoder(recorder.Body).Decode
 			handle = rest.ErrorXML
+			kind = "application/problem+xml; charset=utf-8"
 		})
 
 		ItHandlesTheError()
 	})
+
+	Context("when the client accepts application/xml", func() {
+		BeforeEach(func() {
+			request = NewJSONRequest(nil)
+			request.Header.Set("Accept", "application/xml")
+			recorder = httptest.NewRecorder()
+			decode = xml.NewDecoder(recorder.Body).Decode
+			handle = rest.Error
+			kind = "application/problem+xml; charset=utf-8"
+		})
+
+		ItHandlesTheError()
+	})
+})
+
+var _ = Describe("middleware.ErrorResponder", func() {
+	It("renders the errors of the middlewares as problems", func() {
+		var (
+			request  = httptest.NewRequest("GET", "http://example.com", nil)
+			recorder = httptest.NewRecorder()
+		)
+
+		middleware.ErrorResponder(recorder, request, errors.New("oh no").AddTag("status", http.StatusConflict))
+		Expect(recorder.Code).To(Equal(http.StatusConflict))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/problem+json; charset=utf-8"))
+	})
+})
+
+var _ = Describe("Tracing", func() {
+	It("records the error on the span", func() {
+		var (
+			exporter = tracetest.NewInMemoryExporter()
+			provider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			recorder = httptest.NewRecorder()
+		)
+
+		handler := middleware.TracingWithOption(middleware.TracingWithTracerProvider(provider))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rest.Error(w, r, errors.New("oh no"))
+		}))
+
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com", nil))
+		Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Status.Code).To(Equal(codes.Error))
+		Expect(spans[0].Events).To(HaveLen(1))
+		Expect(spans[0].Events[0].Name).To(Equal("exception"))
+	})
+})
+
+var _ = Describe("middleware.Recoverer", func() {
+	panicky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oh no")
+	})
+
+	It("renders the panic as a problem", func() {
+		var (
+			request  = httptest.NewRequest("GET", "http://example.com", nil)
+			recorder = httptest.NewRecorder()
+		)
+
+		request.Header.Set("Accept", "application/xml")
+
+		middleware.Recoverer(panicky).ServeHTTP(recorder, request)
+		Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/problem+xml; charset=utf-8"))
+		Expect(recorder.Body.String()).NotTo(ContainSubstring("oh no"))
+		Expect(recorder.Body.String()).NotTo(ContainSubstring("runtime/debug.Stack"))
+	})
+
+	Context("when the development mode is enabled", func() {
+		It("renders the cause and the stack", func() {
+			var (
+				request  = httptest.NewRequest("GET", "http://example.com", nil)
+				recorder = httptest.NewRecorder()
+			)
+
+			middleware.RecovererWithOption(middleware.RecovererWithDevelopment())(panicky).ServeHTTP(recorder, request)
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+
+			problem := map[string]interface{}{}
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &problem)).To(Succeed())
+			Expect(problem).To(HaveKeyWithValue("detail", "panic: oh no"))
+			Expect(problem).To(HaveKeyWithValue("stack", ContainSubstring("runtime/debug.Stack")))
+		})
+	})
 })
@@ -0,0 +1,148 @@
+package rest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-playground/errors/v5"
+	"github.com/phogolabs/rest/middleware"
+)
+
+var etagCtxKey = &middleware.ContextKey{Name: "ETagConfig"}
+
+// ETagConfig represents the configuration of the ETags computed by Respond
+type ETagConfig struct {
+	// Weak computes weak ETags
+	Weak bool
+}
+
+// ETagOption represents an ETag option
+type ETagOption func(config *ETagConfig)
+
+// ETagWithWeak computes weak ETags, which are suitable for the responses that
+// are semantically equivalent but not byte for byte identical
+func ETagWithWeak() ETagOption {
+	return func(config *ETagConfig) {
+		config.Weak = true
+	}
+}
+
+// ETagWithOption returns a middleware that makes Respond compute the ETag of
+// the responses of a route from their encoded body. The ETag set by the
+// handler takes precedence. Respond answers the GET and HEAD requests with
+// 304 Not Modified if the ETag matches the If-None-Match header.
+func ETagWithOption(options ...ETagOption) func(http.Handler) http.Handler {
+	config := ETagConfig{}
+
+	for _, option := range options {
+		option(&config)
+	}
+
+	mw := func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), etagCtxKey, config)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return mw
+}
+
+// Precondition evaluates the If-Match and If-Unmodified-Since headers against
+// the current ETag and modification time of the resource. An empty ETag means
+// that the resource does not exist. A zero time means that the modification
+// time is unknown. The error responds with 412 Precondition Failed.
+func Precondition(r *http.Request, etag string, modified time.Time) error {
+	if header := r.Header.Get("If-Match"); header != "" {
+		if etag == "" || !etagMatch(header, etag, false) {
+			return errors.New("the resource does not match the If-Match header").
+				AddTag("status", http.StatusPreconditionFailed)
+		}
+
+		// If-Unmodified-Since is ignored when If-Match is present
+		return nil
+	}
+
+	if header := r.Header.Get("If-Unmodified-Since"); header != "" && !modified.IsZero() {
+		since, err := http.ParseTime(header)
+		if err != nil {
+			return nil
+		}
+
+		if modified.Truncate(time.Second).After(since) {
+			return errors.New("the resource has been modified since the If-Unmodified-Since header").
+				AddTag("status", http.StatusPreconditionFailed)
+		}
+	}
+
+	return nil
+}
+
+// etagRespond sets the ETag of the response. It reports whether the response
+// is not modified according to the If-None-Match header.
+func etagRespond(w http.ResponseWriter, r *http.Request, data []byte) bool {
+	etag := w.Header().Get("ETag")
+
+	if etag == "" {
+		config, ok := r.Context().Value(etagCtxKey).(ETagConfig)
+		if !ok {
+			return false
+		}
+
+		etag = etagOf(data, config.Weak)
+		w.Header().Set("ETag", etag)
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	return etagMatch(header, etag, true)
+}
+
+// etagOf computes the ETag of the data
+func etagOf(data []byte, weak bool) string {
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	if weak {
+		etag = "W/" + etag
+	}
+
+	return etag
+}
+
+// etagMatch reports whether the ETag matches one of the ETags of the header.
+// The weak comparison ignores the weak indicator, while the strong comparison
+// requires both ETags to be strong.
+func etagMatch(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		switch {
+		case candidate == "*":
+			return true
+		case weak:
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		default:
+			if !strings.HasPrefix(candidate, "W/") && !strings.HasPrefix(etag, "W/") && candidate == etag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
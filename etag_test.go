@@ -0,0 +1,148 @@
+package rest_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/phogolabs/rest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ETag", func() {
+	var (
+		handler http.Handler
+		etag    string
+	)
+
+	BeforeEach(func() {
+		etag = ""
+	})
+
+	JustBeforeEach(func() {
+		handler = rest.ETagWithOption()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if etag != "" {
+				w.Header().Set("ETag", etag)
+			}
+
+			rest.Respond(w, r, &Contact{Phone: "+188123451"})
+		}))
+	})
+
+	It("computes the ETag of the response", func() {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com", nil))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("ETag")).To(MatchRegexp(`^"[0-9a-f]{32}"$`))
+	})
+
+	It("responds with 304 when the ETag matches", func() {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com", nil))
+
+		request := httptest.NewRequest("GET", "http://example.com", nil)
+		request.Header.Set("If-None-Match", `"other", `+recorder.Header().Get("ETag"))
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		Expect(recorder.Code).To(Equal(http.StatusNotModified))
+		Expect(recorder.Body.Len()).To(BeZero())
+	})
+
+	Context("when the handler sets the ETag", func() {
+		BeforeEach(func() {
+			etag = `W/"v1"`
+		})
+
+		It("uses the ETag of the handler", func() {
+			request := httptest.NewRequest("GET", "http://example.com", nil)
+			request.Header.Set("If-None-Match", `"v1"`)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusNotModified))
+			Expect(recorder.Header().Get("ETag")).To(Equal(`W/"v1"`))
+		})
+	})
+
+	Context("when the ETag is weak", func() {
+		It("computes a weak ETag", func() {
+			handler = rest.ETagWithOption(rest.ETagWithWeak())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rest.Respond(w, r, &Contact{Phone: "+188123451"})
+			}))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com", nil))
+
+			Expect(recorder.Header().Get("ETag")).To(HavePrefix(`W/"`))
+		})
+	})
+})
+
+var _ = Describe("Precondition", func() {
+	var (
+		request  *http.Request
+		modified time.Time
+	)
+
+	BeforeEach(func() {
+		request = httptest.NewRequest("PUT", "http://example.com", nil)
+		modified = time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	})
+
+	It("succeeds when the ETag matches", func() {
+		request.Header.Set("If-Match", `"v1", "v2"`)
+		Expect(rest.Precondition(request, `"v2"`, modified)).To(Succeed())
+	})
+
+	It("succeeds when there are no preconditions", func() {
+		Expect(rest.Precondition(request, `"v1"`, modified)).To(Succeed())
+	})
+
+	Context("when the ETag does not match", func() {
+		It("responds with 412", func() {
+			request.Header.Set("If-Match", `"v1"`)
+
+			err := rest.Precondition(request, `"v2"`, modified)
+			Expect(err).To(HaveOccurred())
+
+			recorder := httptest.NewRecorder()
+			rest.Respond(recorder, request, err)
+			Expect(recorder.Code).To(Equal(http.StatusPreconditionFailed))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/problem+json; charset=utf-8"))
+		})
+	})
+
+	Context("when the ETag is weak", func() {
+		It("returns an error", func() {
+			request.Header.Set("If-Match", `W/"v1"`)
+			Expect(rest.Precondition(request, `W/"v1"`, modified)).NotTo(Succeed())
+		})
+	})
+
+	Context("when the resource does not exist", func() {
+		It("returns an error", func() {
+			request.Header.Set("If-Match", "*")
+			Expect(rest.Precondition(request, "", modified)).NotTo(Succeed())
+		})
+	})
+
+	Context("when the resource has been modified", func() {
+		It("returns an error", func() {
+			request.Header.Set("If-Unmodified-Since", modified.Add(-time.Hour).Format(http.TimeFormat))
+			Expect(rest.Precondition(request, `"v1"`, modified)).NotTo(Succeed())
+		})
+	})
+
+	Context("when the resource has not been modified", func() {
+		It("succeeds", func() {
+			request.Header.Set("If-Unmodified-Since", modified.Format(http.TimeFormat))
+			Expect(rest.Precondition(request, `"v1"`, modified.Add(500*time.Millisecond))).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,178 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentTypeEventStream is the media type of the server-sent events
+const ContentTypeEventStream = "text/event-stream"
+
+// DefaultEventHeartbeat is the interval of the heartbeats sent by EventStream
+const DefaultEventHeartbeat = 15 * time.Second
+
+// Event represents a server-sent event
+type Event struct {
+	// ID is the identifier sent back by the client in the Last-Event-ID header
+	ID string
+	// Name is the type of the event
+	Name string
+	// Data is the payload of the event. The strings are sent as they are. The
+	// other values are encoded as JSON.
+	Data interface{}
+	// Retry is the reconnection time of the client
+	Retry time.Duration
+}
+
+// WriteTo writes the event in the event stream format
+func (e *Event) WriteTo(w io.Writer) (int64, error) {
+	buffer := &bytes.Buffer{}
+
+	if e.ID != "" {
+		fmt.Fprintf(buffer, "id: %s\n", eventLine(e.ID))
+	}
+
+	if e.Name != "" {
+		fmt.Fprintf(buffer, "event: %s\n", eventLine(e.Name))
+	}
+
+	if e.Retry > 0 {
+		fmt.Fprintf(buffer, "retry: %d\n", e.Retry.Milliseconds())
+	}
+
+	data, err := eventData(e.Data)
+	if err != nil {
+		return 0, err
+	}
+
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(buffer, "data: %s\n", line)
+	}
+
+	buffer.WriteString("\n")
+
+	return buffer.WriteTo(w)
+}
+
+// EventStore stores the published events, so they can be replayed to the
+// clients that reconnect with the Last-Event-ID header
+type EventStore interface {
+	// Append stores the event
+	Append(ctx context.Context, event *Event) error
+	// Replay returns the events stored after the event with the given id
+	Replay(ctx context.Context, id string) ([]*Event, error)
+}
+
+// EventMemoryStore is an EventStore that keeps the latest events in memory
+type EventMemoryStore struct {
+	mutex    sync.RWMutex
+	capacity int
+	events   []*Event
+}
+
+// NewEventMemoryStore creates a new store that keeps up to capacity events
+func NewEventMemoryStore(capacity int) *EventMemoryStore {
+	return &EventMemoryStore{
+		capacity: capacity,
+	}
+}
+
+// Append stores the event. The oldest event is dropped when the store is full.
+func (s *EventMemoryStore) Append(ctx context.Context, event *Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.events = append(s.events, event)
+
+	if count := len(s.events); s.capacity > 0 && count > s.capacity {
+		s.events = append([]*Event{}, s.events[count-s.capacity:]...)
+	}
+
+	return nil
+}
+
+// Replay returns the events stored after the event with the given id. All
+// events are returned if the event has been dropped already.
+func (s *EventMemoryStore) Replay(ctx context.Context, id string) ([]*Event, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	events := s.events
+
+	for index := len(events) - 1; index >= 0; index-- {
+		if events[index].ID == id {
+			events = events[index+1:]
+			break
+		}
+	}
+
+	return append([]*Event{}, events...), nil
+}
+
+// EventStreamConfig represents the configuration of EventStream
+type EventStreamConfig struct {
+	// Heartbeat is the interval of the heartbeats. They are disabled if the
+	// interval is not positive.
+	Heartbeat time.Duration
+	// Store replays the events missed by the reconnecting clients
+	Store EventStore
+}
+
+// EventStreamOption represents an EventStream option
+type EventStreamOption func(config *EventStreamConfig)
+
+// EventStreamWithHeartbeat sets the interval of the heartbeats
+func EventStreamWithHeartbeat(d time.Duration) EventStreamOption {
+	return func(config *EventStreamConfig) {
+		config.Heartbeat = d
+	}
+}
+
+// EventStreamWithStore sets the store of the replayed events
+func EventStreamWithStore(store EventStore) EventStreamOption {
+	return func(config *EventStreamConfig) {
+		config.Store = store
+	}
+}
+
+func eventData(v interface{}) (string, error) {
+	switch data := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return data, nil
+	case []byte:
+		return string(data), nil
+	default:
+		buffer := &bytes.Buffer{}
+
+		if err := codecEncodeJSON(buffer, data); err != nil {
+			return "", err
+		}
+
+		return strings.TrimSuffix(buffer.String(), "\n"), nil
+	}
+}
+
+func eventLine(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+// eventOf returns the event of a streamed item
+func eventOf(item interface{}) *Event {
+	switch event := item.(type) {
+	case *Event:
+		return event
+	case Event:
+		return &event
+	default:
+		return &Event{Data: item}
+	}
+}
@@ -0,0 +1,87 @@
+package rest_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-playground/errors/v5"
+	"github.com/phogolabs/rest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EventStream", func() {
+	var (
+		request  *http.Request
+		recorder *httptest.ResponseRecorder
+		events   chan interface{}
+	)
+
+	BeforeEach(func() {
+		request = httptest.NewRequest("GET", "http://example.com", nil)
+		recorder = httptest.NewRecorder()
+		events = make(chan interface{}, 3)
+	})
+
+	It("sends the events", func() {
+		events <- &rest.Event{ID: "1", Name: "created", Data: Contact{Phone: "+188123451"}}
+		events <- "hello\nworld"
+		close(events)
+
+		rest.EventStream(recorder, request, events)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("text/event-stream"))
+		Expect(recorder.Header().Get("Cache-Control")).To(Equal("no-cache"))
+		Expect(recorder.Body.String()).To(Equal("id: 1\nevent: created\ndata: {\"phone\":\"+188123451\"}\n\ndata: hello\ndata: world\n\n"))
+	})
+
+	It("sends the heartbeats", func() {
+		ctx, cancel := context.WithTimeout(request.Context(), 50*time.Millisecond)
+		defer cancel()
+
+		rest.EventStream(recorder, request.WithContext(ctx), events, rest.EventStreamWithHeartbeat(5*time.Millisecond))
+		Expect(recorder.Body.String()).To(ContainSubstring(": heartbeat\n\n"))
+	})
+
+	It("replays the events after the last event id", func() {
+		store := rest.NewEventMemoryStore(2)
+
+		for _, id := range []string{"1", "2", "3"} {
+			Expect(store.Append(context.TODO(), &rest.Event{ID: id, Data: id})).To(Succeed())
+		}
+
+		request.Header.Set("Last-Event-ID", "2")
+		close(events)
+
+		rest.EventStream(recorder, request, events, rest.EventStreamWithStore(store))
+		Expect(recorder.Body.String()).To(Equal("id: 3\ndata: 3\n\n"))
+	})
+
+	Context("when the stream fails", func() {
+		It("sends an error event", func() {
+			events <- errors.New("oh no").AddTag("status", http.StatusServiceUnavailable)
+
+			rest.EventStream(recorder, request, events)
+			Expect(recorder.Body.String()).To(HavePrefix("event: error\ndata: {"))
+			Expect(recorder.Body.String()).To(ContainSubstring(`"status":503`))
+		})
+	})
+})
+
+var _ = Describe("EventMemoryStore", func() {
+	It("replays all events when the last event has been dropped", func() {
+		store := rest.NewEventMemoryStore(2)
+
+		for _, id := range []string{"1", "2", "3"} {
+			Expect(store.Append(context.TODO(), &rest.Event{ID: id})).To(Succeed())
+		}
+
+		events, err := store.Replay(context.TODO(), "1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].ID).To(Equal("2"))
+	})
+})
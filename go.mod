@@ -1,14 +1,11 @@
 module github.com/phogolabs/rest
 
 require (
-	github.com/DATA-DOG/golang-websocket-hub v0.0.0-20160116191846-33749930961c
 	github.com/creasty/defaults v1.6.0
 	github.com/fsnotify/fsnotify v1.6.0
 	github.com/go-chi/chi/v5 v5.0.8 //in.comdirect
 	github.com/go-chi/render v1.0.2
-	github.com/go-playground/errors v3.3.0+incompatible
 	github.com/go-playground/validator/v10 v10.11.2
-	github.com/goware/errorx v0.0.0-20150526135951-6c5540545f5f
 	github.com/hashicorp/go-multierror v1.1.1
 	github.com/onsi/gomega v1.26.0
 	github.com/phogolabs/log v0.0.0-20230111045248-dad4d3c50e0f
@@ -16,7 +13,7 @@ require (
 )
 
 require (
-	github.com/gorilla/websocket v1.5.0 // indirect; in.comdirect
+	github.com/gorilla/websocket v1.5.0 // in.comdirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect; in.comdirect
 	github.com/phogolabs/flaw v0.0.0-20230111045222-8efffb46800b // indirect; in.comdirect
 	golang.org/x/crypto v0.7.0 // indirect
@@ -24,9 +21,16 @@ require (
 )
 
 require (
+	github.com/go-playground/errors v3.3.0+incompatible
 	github.com/go-playground/errors/v5 v5.2.3
 	github.com/go-playground/form/v4 v4.2.0
+	github.com/go-playground/locales v0.14.1
+	github.com/go-playground/universal-translator v0.18.1
 	github.com/onsi/ginkgo/v2 v2.8.1
+	github.com/prometheus/client_model v0.3.0
+	go.opentelemetry.io/otel v1.14.0
+	go.opentelemetry.io/otel/sdk v1.14.0
+	go.opentelemetry.io/otel/trace v1.14.0
 )
 
 require (
@@ -35,9 +39,8 @@ require (
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/fatih/color v1.13.0 // indirect
 	github.com/go-logr/logr v1.2.3 // indirect
-	github.com/go-playground/locales v0.14.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/go-playground/pkg/v5 v5.15.2 // indirect
-	github.com/go-playground/universal-translator v0.18.1 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/google/go-cmp v0.5.9 // indirect
 	github.com/kr/text v0.2.0 // indirect
@@ -45,7 +48,6 @@ require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.16 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
-	github.com/prometheus/client_model v0.3.0 // indirect
 	github.com/prometheus/common v0.41.0 // indirect
 	github.com/prometheus/procfs v0.9.0 // indirect
 	github.com/rogpeppe/go-internal v1.9.0 // indirect
@@ -1,8 +1,12 @@
 package middleware
 
 import (
+	"context"
+	"net/http"
+
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
+	"github.com/go-playground/errors/v5"
 )
 
 var (
@@ -57,3 +61,48 @@ type ContextKey struct {
 func (k *ContextKey) String() string {
 	return "rest/middleware context value " + k.Name
 }
+
+// ProblemExtensionPrefix is the prefix of the error tags that are rendered as
+// problem details extension members by the rest package
+const ProblemExtensionPrefix = "extension:"
+
+// ErrorResponder renders and logs the errors of the middlewares. The status
+// code is read from the status tag of the error. The body is the status text,
+// so the details of the error are not exposed. The rest package replaces it
+// with rest.Respond, so the errors are rendered as problem documents.
+var ErrorResponder = func(w http.ResponseWriter, r *http.Request, err error) {
+	status, ok := errors.LookupTag(err, "status").(int)
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	logger := GetLogger(r).
+		WithError(err).
+		WithField("status", status)
+
+	switch {
+	case status >= 500:
+		logger.Error("occurred")
+	case status >= 400:
+		logger.Warn("occurred")
+	default:
+		logger.Info("occurred")
+	}
+
+	http.Error(w, http.StatusText(status), status)
+}
+
+var principalCtxKey = &ContextKey{Name: "Principal"}
+
+// SetPrincipal returns a copy of the request with the authenticated principal.
+// It is meant to be called by the authentication middlewares.
+func SetPrincipal(r *http.Request, principal string) *http.Request {
+	ctx := context.WithValue(r.Context(), principalCtxKey, principal)
+	return r.WithContext(ctx)
+}
+
+// GetPrincipal returns the authenticated principal of the request
+func GetPrincipal(r *http.Request) string {
+	principal, _ := r.Context().Value(principalCtxKey).(string)
+	return principal
+}
@@ -0,0 +1,383 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/errors/v5"
+)
+
+// IdempotencyRecord represents the recorded response of an idempotent request
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request that produced the response
+	Fingerprint string
+	// Status is the status code of the response
+	Status int
+	// Header is the header of the response
+	Header http.Header
+	// Body is the body of the response
+	Body []byte
+}
+
+// IdempotencyStore stores the responses of the idempotent requests
+type IdempotencyStore interface {
+	// Lock locks the key. It returns false if the key is locked already.
+	Lock(ctx context.Context, key string) (bool, error)
+	// Unlock unlocks the key
+	Unlock(ctx context.Context, key string) error
+	// Get returns the record of the key. It returns nil if there is no record.
+	Get(ctx context.Context, key string) (*IdempotencyRecord, error)
+	// Put stores the record of the key
+	Put(ctx context.Context, key string, record *IdempotencyRecord) error
+}
+
+// IdempotencyMemoryStore is an IdempotencyStore that keeps the records in
+// memory
+type IdempotencyMemoryStore struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	locks   map[string]bool
+	records map[string]*idempotencyEntry
+	pruned  time.Time
+}
+
+type idempotencyEntry struct {
+	record  *IdempotencyRecord
+	expires time.Time
+}
+
+// NewIdempotencyMemoryStore creates a new store that keeps the records for the
+// given duration. The records do not expire if the duration is zero.
+func NewIdempotencyMemoryStore(ttl time.Duration) *IdempotencyMemoryStore {
+	return &IdempotencyMemoryStore{
+		ttl:     ttl,
+		locks:   make(map[string]bool),
+		records: make(map[string]*idempotencyEntry),
+		pruned:  time.Now(),
+	}
+}
+
+// Lock locks the key. It returns false if the key is locked already.
+func (s *IdempotencyMemoryStore) Lock(ctx context.Context, key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.locks[key] {
+		return false, nil
+	}
+
+	s.locks[key] = true
+	return true, nil
+}
+
+// Unlock unlocks the key
+func (s *IdempotencyMemoryStore) Unlock(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.locks, key)
+	return nil
+}
+
+// Get returns the record of the key
+func (s *IdempotencyMemoryStore) Get(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(s.records, key)
+		return nil, nil
+	}
+
+	return entry.record, nil
+}
+
+// Put stores the record of the key
+func (s *IdempotencyMemoryStore) Put(ctx context.Context, key string, record *IdempotencyRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var (
+		now   = time.Now()
+		entry = &idempotencyEntry{record: record}
+	)
+
+	s.prune(now)
+
+	if s.ttl > 0 {
+		entry.expires = now.Add(s.ttl)
+	}
+
+	s.records[key] = entry
+	return nil
+}
+
+// prune removes the expired records. The records are checked at most once per
+// ttl.
+func (s *IdempotencyMemoryStore) prune(now time.Time) {
+	if s.ttl <= 0 || now.Sub(s.pruned) < s.ttl {
+		return
+	}
+
+	for key, entry := range s.records {
+		if now.After(entry.expires) {
+			delete(s.records, key)
+		}
+	}
+
+	s.pruned = now
+}
+
+// DefaultIdempotencyMaxBytes is the size limit of the bodies of the
+// idempotent requests
+const DefaultIdempotencyMaxBytes = 1 << 20
+
+// IdempotencyKeyFunc returns the scope of the idempotency keys of the request,
+// e.g. the authenticated principal
+type IdempotencyKeyFunc func(r *http.Request) string
+
+// IdempotencyConfig represents the configuration of the Idempotency middleware
+type IdempotencyConfig struct {
+	// KeyFunc returns the scope of the idempotency keys. The keys of different
+	// scopes do not share their responses.
+	KeyFunc IdempotencyKeyFunc
+	// MaxBytes limits the size of the request body
+	MaxBytes int64
+}
+
+// IdempotencyOption represents an idempotency option
+type IdempotencyOption func(config *IdempotencyConfig)
+
+// IdempotencyWithKeyFunc sets the function that returns the scope of the
+// idempotency keys
+func IdempotencyWithKeyFunc(fn IdempotencyKeyFunc) IdempotencyOption {
+	return func(config *IdempotencyConfig) {
+		config.KeyFunc = fn
+	}
+}
+
+// IdempotencyWithMaxBytes limits the size of the request body
+func IdempotencyWithMaxBytes(n int64) IdempotencyOption {
+	return func(config *IdempotencyConfig) {
+		config.MaxBytes = n
+	}
+}
+
+// IdempotencyWithOption returns a middleware that makes the POST and PATCH
+// requests with an Idempotency-Key header safe to retry. The response of the
+// first request is recorded in the store and replayed on the retries with the
+// same key, method and path in the same scope, which is the principal of the
+// request by default. The replayed responses have the Idempotent-Replayed
+// header. It responds with 409 Conflict if a request with the same key is in
+// progress, with 413 Request Entity Too Large if the body exceeds the limit and
+// with 422 Unprocessable Entity if the key is reused with a different request.
+// The server errors are not recorded, so the request can be retried.
+func IdempotencyWithOption(store IdempotencyStore, options ...IdempotencyOption) func(http.Handler) http.Handler {
+	config := &IdempotencyConfig{
+		KeyFunc:  GetPrincipal,
+		MaxBytes: DefaultIdempotencyMaxBytes,
+	}
+
+	for _, option := range options {
+		option(config)
+	}
+
+	mw := func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Idempotency-Key")
+
+			if header == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := idempotencyKey(config.KeyFunc(r), r.Method, r.URL.Path, header)
+
+			ctx := r.Context()
+
+			fingerprint, err := idempotencyFingerprint(r, config.MaxBytes)
+			if err != nil {
+				status := http.StatusBadRequest
+
+				if err == errIdempotencyBodyTooLarge {
+					status = http.StatusRequestEntityTooLarge
+				}
+
+				ErrorResponder(w, r, errors.Wrap(err, "idempotency").AddTag("status", status))
+				return
+			}
+
+			ok, err := store.Lock(ctx, key)
+			if err != nil {
+				ErrorResponder(w, r, errors.Wrap(err, "idempotency"))
+				return
+			}
+
+			if !ok {
+				err := errors.New("a request with the same idempotency key is in progress").
+					AddTag("status", http.StatusConflict)
+
+				ErrorResponder(w, r, err)
+				return
+			}
+
+			// the key is unlocked even if the client disconnects
+			detached := idempotencyContext{ctx}
+
+			//nolint:errcheck
+			defer store.Unlock(detached, key)
+
+			record, err := store.Get(ctx, key)
+			if err != nil {
+				ErrorResponder(w, r, errors.Wrap(err, "idempotency"))
+				return
+			}
+
+			if record != nil {
+				if record.Fingerprint != fingerprint {
+					err := errors.New("the idempotency key is reused with a different request").
+						AddTag("status", http.StatusUnprocessableEntity)
+
+					ErrorResponder(w, r, err)
+					return
+				}
+
+				for name, values := range record.Header {
+					w.Header()[name] = values
+				}
+
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(record.Status)
+				//nolint:errcheck
+				w.Write(record.Body)
+				return
+			}
+
+			var (
+				body   = &bytes.Buffer{}
+				writer = middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			)
+
+			writer.Tee(body)
+			next.ServeHTTP(writer, r)
+
+			status := writer.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			if status >= http.StatusInternalServerError {
+				return
+			}
+
+			record = &IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Status:      status,
+				Header:      w.Header().Clone(),
+				Body:        body.Bytes(),
+			}
+
+			//nolint:errcheck
+			store.Put(detached, key, record)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return mw
+}
+
+// Idempotency returns a middleware that makes the POST and PATCH requests with
+// an Idempotency-Key header safe to retry. The keys are scoped by the
+// principal of the request.
+func Idempotency(store IdempotencyStore) func(http.Handler) http.Handler {
+	return IdempotencyWithOption(store)
+}
+
+// idempotencyContext carries the values of the request context without its
+// cancellation and deadline
+type idempotencyContext struct {
+	parent context.Context
+}
+
+// Deadline returns no deadline
+func (idempotencyContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done returns nil, as the context is never canceled
+func (idempotencyContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Err returns nil, as the context is never canceled
+func (idempotencyContext) Err() error {
+	return nil
+}
+
+// Value returns the value of the request context
+func (c idempotencyContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+var errIdempotencyBodyTooLarge = fmt.Errorf("request body too large")
+
+// idempotencyKey returns the key of the store, so the same header sent by
+// different principals or to different routes does not share the response
+func idempotencyKey(scope, method, path, key string) string {
+	hash := sha256.New()
+
+	for _, part := range []string{scope, method, path, key} {
+		//nolint:errcheck
+		io.WriteString(hash, strconv.Quote(part))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// idempotencyFingerprint computes the fingerprint of the method, the URL and
+// the body of the request. The body is restored afterwards. It fails if the
+// body exceeds the limit.
+func idempotencyFingerprint(r *http.Request, limit int64) (string, error) {
+	hash := sha256.New()
+
+	//nolint:errcheck
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n")
+
+	if r.Body != nil && r.Body != http.NoBody {
+		reader := r.Body
+
+		if limit > 0 {
+			reader = io.NopCloser(io.LimitReader(r.Body, limit+1))
+		}
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return "", err
+		}
+
+		if limit > 0 && int64(len(data)) > limit {
+			return "", errIdempotencyBodyTooLarge
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		//nolint:errcheck
+		hash.Write(data)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,224 @@
+package middleware_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/phogolabs/rest/middleware"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Idempotency", func() {
+	var (
+		count    int
+		store    *middleware.IdempotencyMemoryStore
+		endpoint http.Handler
+		handler  http.Handler
+	)
+
+	NewRequest := func(body string) *http.Request {
+		request := httptest.NewRequest("POST", "http://example.com/payments", strings.NewReader(body))
+		request.Header.Set("Idempotency-Key", "key-1")
+		return request
+	}
+
+	BeforeEach(func() {
+		count = 0
+		store = middleware.NewIdempotencyMemoryStore(time.Hour)
+
+		endpoint = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+
+			data, err := io.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+
+			w.Header().Set("Location", "/payments/1")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(data)
+		})
+
+		handler = middleware.Idempotency(store)(endpoint)
+	})
+
+	It("replays the first response", func() {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, NewRequest("amount=10"))
+		Expect(recorder.Code).To(Equal(http.StatusCreated))
+		Expect(recorder.Header().Get("Idempotent-Replayed")).To(BeEmpty())
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, NewRequest("amount=10"))
+		Expect(recorder.Code).To(Equal(http.StatusCreated))
+		Expect(recorder.Header().Get("Location")).To(Equal("/payments/1"))
+		Expect(recorder.Header().Get("Idempotent-Replayed")).To(Equal("true"))
+		Expect(recorder.Body.String()).To(Equal("amount=10"))
+
+		Expect(count).To(Equal(1))
+	})
+
+	Context("when the request does not have a key", func() {
+		It("serves every request", func() {
+			for index := 0; index < 2; index++ {
+				request := NewRequest("amount=10")
+				request.Header.Del("Idempotency-Key")
+
+				handler.ServeHTTP(httptest.NewRecorder(), request)
+			}
+
+			Expect(count).To(Equal(2))
+		})
+	})
+
+	Context("when the key is reused with a different request", func() {
+		It("responds with 422", func() {
+			handler.ServeHTTP(httptest.NewRecorder(), NewRequest("amount=10"))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, NewRequest("amount=20"))
+			Expect(recorder.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(count).To(Equal(1))
+		})
+	})
+
+	Context("when a request with the same key is in progress", func() {
+		It("responds with 409", func() {
+			var (
+				started = make(chan struct{})
+				release = make(chan struct{})
+				done    = make(chan struct{})
+			)
+
+			handler = middleware.Idempotency(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				<-release
+			}))
+
+			go func() {
+				defer close(done)
+				handler.ServeHTTP(httptest.NewRecorder(), NewRequest("amount=10"))
+			}()
+
+			<-started
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, NewRequest("amount=10"))
+			Expect(recorder.Code).To(Equal(http.StatusConflict))
+
+			close(release)
+			<-done
+		})
+	})
+
+	Context("when the client disconnects", func() {
+		It("unlocks the key", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			handler = middleware.Idempotency(&ContextStore{store})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				cancel()
+				w.WriteHeader(http.StatusCreated)
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), NewRequest("amount=10").WithContext(ctx))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, NewRequest("amount=10"))
+			Expect(recorder.Code).To(Equal(http.StatusCreated))
+			Expect(recorder.Header().Get("Idempotent-Replayed")).To(Equal("true"))
+		})
+	})
+
+	Context("when the key is sent by different principals", func() {
+		It("does not replay the response of the other principal", func() {
+			handler.ServeHTTP(httptest.NewRecorder(), middleware.SetPrincipal(NewRequest("amount=10"), "jack"))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, middleware.SetPrincipal(NewRequest("amount=10"), "john"))
+			Expect(recorder.Header().Get("Idempotent-Replayed")).To(BeEmpty())
+			Expect(count).To(Equal(2))
+		})
+	})
+
+	Context("when the key is sent to a different route", func() {
+		It("does not replay the response of the other route", func() {
+			handler.ServeHTTP(httptest.NewRecorder(), NewRequest("amount=10"))
+
+			request := NewRequest("amount=10")
+			request.URL.Path = "/refunds"
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			Expect(recorder.Header().Get("Idempotent-Replayed")).To(BeEmpty())
+			Expect(count).To(Equal(2))
+		})
+	})
+
+	Context("when the scope is set by the key func", func() {
+		It("replays the response in the same scope", func() {
+			handler = middleware.IdempotencyWithOption(store, middleware.IdempotencyWithKeyFunc(func(r *http.Request) string {
+				return r.Header.Get("X-Tenant")
+			}))(endpoint)
+
+			for _, tenant := range []string{"acme", "acme", "globex"} {
+				request := NewRequest("amount=10")
+				request.Header.Set("X-Tenant", tenant)
+
+				handler.ServeHTTP(httptest.NewRecorder(), request)
+			}
+
+			Expect(count).To(Equal(2))
+		})
+	})
+
+	Context("when the body exceeds the limit", func() {
+		It("responds with 413", func() {
+			handler = middleware.IdempotencyWithOption(store, middleware.IdempotencyWithMaxBytes(4))(endpoint)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, NewRequest("amount=10"))
+			Expect(recorder.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(recorder.Body.String()).To(Equal(http.StatusText(http.StatusRequestEntityTooLarge) + "\n"))
+			Expect(count).To(BeZero())
+		})
+	})
+
+	Context("when the response is a server error", func() {
+		It("does not record the response", func() {
+			handler = middleware.Idempotency(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				count++
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), NewRequest("amount=10"))
+			handler.ServeHTTP(httptest.NewRecorder(), NewRequest("amount=10"))
+
+			Expect(count).To(Equal(2))
+		})
+	})
+})
+
+// ContextStore fails like the external stores when the context is canceled
+type ContextStore struct {
+	*middleware.IdempotencyMemoryStore
+}
+
+func (s *ContextStore) Unlock(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.IdempotencyMemoryStore.Unlock(ctx, key)
+}
+
+func (s *ContextStore) Put(ctx context.Context, key string, record *middleware.IdempotencyRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.IdempotencyMemoryStore.Put(ctx, key, record)
+}
@@ -1,13 +1,68 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/phogolabs/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var loggerCtxKey = &ContextKey{Name: "LoggerState"}
+
+// loggerState tracks the fields added by the handlers and the requests that
+// are served as long-lived streams
+type loggerState struct {
+	mutex  sync.Mutex
+	fields log.Map
+	stream bool
+	opened time.Time
+}
+
+// add adds the fields
+func (s *loggerState) add(kv log.Map) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.fields == nil {
+		s.fields = log.Map{}
+	}
+
+	for key, value := range kv {
+		s.fields[key] = value
+	}
+}
+
+// copy returns a copy of the fields
+func (s *loggerState) copy() log.Map {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fields := log.Map{}
+
+	for key, value := range s.fields {
+		fields[key] = value
+	}
+
+	return fields
+}
+
 // LoggerOption represent a logger option
 type LoggerOption interface {
 	Apply(logger log.Logger) log.Logger
@@ -30,8 +85,229 @@ func LoggerOptionWithFields(kv log.Map) LoggerOption {
 	return LoggerOptionFunc(fn)
 }
 
+// LoggerFieldsFunc derives the logger fields from the request. It implements
+// LoggerOption, so it can be passed to LoggerWithOption. The function is
+// called at the start of the request and again on completion, when the route
+// pattern is resolved. The values set in the request context by the inner
+// middlewares are not visible to it, so the authentication middleware should
+// precede the Logger.
+type LoggerFieldsFunc func(r *http.Request) log.Map
+
+// Apply returns the logger as it is
+func (fn LoggerFieldsFunc) Apply(logger log.Logger) log.Logger {
+	return logger
+}
+
+// LoggerRequestFields derives the route pattern, the trace ID and the
+// principal of the request
+var LoggerRequestFields LoggerFieldsFunc = func(r *http.Request) log.Map {
+	fields := log.Map{}
+
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			fields["route"] = pattern
+		}
+	}
+
+	if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+		fields["trace_id"] = sc.TraceID().String()
+	}
+
+	if principal := GetPrincipal(r); principal != "" {
+		fields["principal"] = principal
+	}
+
+	return fields
+}
+
+// LoggerFormat represents the format of the access log
+type LoggerFormat string
+
+const (
+	// LoggerFormatStructured logs the requests with the request logger
+	LoggerFormatStructured LoggerFormat = "structured"
+	// LoggerFormatJSON writes the requests as JSON lines to the output
+	LoggerFormatJSON LoggerFormat = "json"
+	// LoggerFormatCommon writes the requests in the Common Log Format to the
+	// output
+	LoggerFormatCommon LoggerFormat = "common"
+	// LoggerFormatCombined writes the requests in the Combined Log Format to
+	// the output
+	LoggerFormatCombined LoggerFormat = "combined"
+)
+
+// LoggerAttribute represents an optional attribute of the access log
+type LoggerAttribute string
+
+const (
+	// LoggerAttributeUserAgent is the User-Agent header of the request
+	LoggerAttributeUserAgent LoggerAttribute = "user_agent"
+	// LoggerAttributeReferer is the Referer header of the request
+	LoggerAttributeReferer LoggerAttribute = "referer"
+	// LoggerAttributeRoute is the chi route pattern of the request
+	LoggerAttributeRoute LoggerAttribute = "route"
+)
+
+// LoggerConfig represents the configuration of the Logger middleware
+type LoggerConfig struct {
+	// Format is the format of the access log
+	Format LoggerFormat
+	// Output is the output of the JSON, the Common and the Combined formats
+	Output io.Writer
+	// Attributes are the optional attributes of the structured and the JSON
+	// formats
+	Attributes []LoggerAttribute
+	// RequestHeaders are the request headers of the structured and the JSON
+	// formats
+	RequestHeaders []string
+	// ResponseHeaders are the response headers of the structured and the
+	// JSON formats
+	ResponseHeaders []string
+	// Exclude are the path patterns of the requests that are not logged
+	Exclude []string
+	// Sampling is the fraction of the 2xx responses that are logged
+	Sampling float64
+	// BodyLimit is the number of bytes of the request and the response bodies
+	// that are captured. The bodies are not captured if it is zero.
+	BodyLimit int
+	// RedactJSON are the paths of the JSON body members that are redacted
+	RedactJSON []string
+	// RedactForm are the names of the form body fields that are redacted
+	RedactForm []string
+	// RedactHeaders are the names of the headers that are redacted
+	RedactHeaders []string
+}
+
+// LoggerConfigOption configures the Logger middleware. It implements
+// LoggerOption, so it can be mixed with the other logger options.
+type LoggerConfigOption func(config *LoggerConfig)
+
+// Apply returns the logger as it is
+func (fn LoggerConfigOption) Apply(logger log.Logger) log.Logger {
+	return logger
+}
+
+// LoggerWithFormat sets the format of the access log
+func LoggerWithFormat(format LoggerFormat) LoggerConfigOption {
+	return func(config *LoggerConfig) {
+		config.Format = format
+	}
+}
+
+// LoggerWithOutput sets the output of the JSON, the Common and the Combined
+// formats
+func LoggerWithOutput(output io.Writer) LoggerConfigOption {
+	return func(config *LoggerConfig) {
+		config.Output = output
+	}
+}
+
+// LoggerWithAttributes adds optional attributes to the access log
+func LoggerWithAttributes(attributes ...LoggerAttribute) LoggerConfigOption {
+	return func(config *LoggerConfig) {
+		config.Attributes = append(config.Attributes, attributes...)
+	}
+}
+
+// LoggerWithRequestHeaders adds the request headers to the access log
+func LoggerWithRequestHeaders(names ...string) LoggerConfigOption {
+	return func(config *LoggerConfig) {
+		config.RequestHeaders = append(config.RequestHeaders, names...)
+	}
+}
+
+// LoggerWithResponseHeaders adds the response headers to the access log
+func LoggerWithResponseHeaders(names ...string) LoggerConfigOption {
+	return func(config *LoggerConfig) {
+		config.ResponseHeaders = append(config.ResponseHeaders, names...)
+	}
+}
+
+// LoggerWithExclude excludes the requests whose path matches any of the
+// patterns, e.g. the Heartbeat endpoint. The patterns have the syntax of
+// path.Match.
+func LoggerWithExclude(patterns ...string) LoggerConfigOption {
+	return func(config *LoggerConfig) {
+		config.Exclude = append(config.Exclude, patterns...)
+	}
+}
+
+// LoggerWithSampling logs only the given fraction of the 2xx responses. The
+// other responses are always logged.
+func LoggerWithSampling(rate float64) LoggerConfigOption {
+	return func(config *LoggerConfig) {
+		config.Sampling = rate
+	}
+}
+
+// LoggerWithBody captures up to limit bytes of the textual request and
+// response bodies in the structured and the JSON formats. The binary bodies
+// are skipped. The handler reads the request body as it is.
+func LoggerWithBody(limit int) LoggerConfigOption {
+	return func(config *LoggerConfig) {
+		config.BodyLimit = limit
+	}
+}
+
+// LoggerWithRedactJSON redacts the members of the captured JSON bodies. The
+// paths are dot separated member names, e.g. user.password. The arrays are
+// traversed implicitly and * matches any member.
+func LoggerWithRedactJSON(paths ...string) LoggerConfigOption {
+	return func(config *LoggerConfig) {
+		config.RedactJSON = append(config.RedactJSON, paths...)
+	}
+}
+
+// LoggerWithRedactForm redacts the fields of the captured form bodies
+func LoggerWithRedactForm(names ...string) LoggerConfigOption {
+	return func(config *LoggerConfig) {
+		config.RedactForm = append(config.RedactForm, names...)
+	}
+}
+
+// LoggerWithRedactHeaders redacts the headers in addition to the
+// Authorization, Cookie and Set-Cookie headers
+func LoggerWithRedactHeaders(names ...string) LoggerConfigOption {
+	return func(config *LoggerConfig) {
+		config.RedactHeaders = append(config.RedactHeaders, names...)
+	}
+}
+
 // LoggerWithOption returns a logger middleware
 func LoggerWithOption(options ...LoggerOption) func(http.Handler) http.Handler {
+	config := &LoggerConfig{
+		Format:        LoggerFormatStructured,
+		Output:        os.Stdout,
+		Sampling:      1,
+		RedactHeaders: []string{"Authorization", "Cookie", "Set-Cookie"},
+	}
+
+	var derivers []LoggerFieldsFunc
+
+	for _, option := range options {
+		switch fn := option.(type) {
+		case LoggerConfigOption:
+			fn(config)
+		case LoggerFieldsFunc:
+			derivers = append(derivers, fn)
+		}
+	}
+
+	derive := func(r *http.Request) log.Map {
+		fields := log.Map{}
+
+		for _, fn := range derivers {
+			for key, value := range fn(r) {
+				fields[key] = value
+			}
+		}
+
+		return fields
+	}
+
+	// the lines of the concurrent requests are not interleaved
+	var mutex sync.Mutex
+
 	mw := func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			var (
@@ -40,33 +316,119 @@ func LoggerWithOption(options ...LoggerOption) func(http.Handler) http.Handler {
 			)
 			// prepare the logger
 			logger := log.GetContext(ctx)
-			// prepare the options
-			options = append(options, LoggerOptionWithFields(meta))
 			// compose the options
 			for _, option := range options {
 				logger = option.Apply(logger)
 			}
 
+			logger = logger.
+				WithFields(meta).
+				WithFields(derive(r))
+
 			// overwrite the context
 			ctx = log.SetContext(ctx, logger)
 
+			state := &loggerState{}
+			ctx = context.WithValue(ctx, loggerCtxKey, state)
+
 			var (
 				writer = middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 				start  = time.Now()
 			)
 
+			var capture *loggerCapture
+
+			if config.BodyLimit > 0 {
+				capture = &loggerCapture{
+					request:  loggerBuffer{limit: config.BodyLimit},
+					response: loggerBuffer{limit: config.BodyLimit},
+				}
+
+				if r.Body != nil && r.Body != http.NoBody {
+					r.Body = &loggerReader{ReadCloser: r.Body, buffer: &capture.request}
+				}
+
+				writer.Tee(&capture.response)
+			}
+
 			next.ServeHTTP(writer, r.WithContext(ctx))
 
+			status := writer.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			if !loggerAccept(config, r, status) {
+				return
+			}
+
+			// the fields derived on completion and added by the handler
+			extra := derive(r)
+
+			for key, value := range state.copy() {
+				extra[key] = value
+			}
+
+			logger = logger.WithFields(extra)
+
+			if state.stream {
+				logger.WithFields(log.Map{
+					"status":   status,
+					"size":     writer.BytesWritten(),
+					"lifetime": time.Since(state.opened),
+				}).Info("stream closed")
+				return
+			}
+
+			switch config.Format {
+			case LoggerFormatCommon, LoggerFormatCombined:
+				line := loggerLine(config.Format, r, status, writer.BytesWritten(), start)
+
+				mutex.Lock()
+				//nolint:errcheck
+				io.WriteString(config.Output, line)
+				mutex.Unlock()
+				return
+			case LoggerFormatJSON:
+				fields := loggerAttributes(config, r, writer.Header(), capture)
+				fields["time"] = start.UTC().Format(time.RFC3339Nano)
+				fields["status"] = status
+				fields["size"] = writer.BytesWritten()
+				fields["duration"] = time.Since(start).Seconds()
+
+				for key, value := range meta {
+					fields[key] = value
+				}
+
+				for key, value := range extra {
+					fields[key] = value
+				}
+
+				data, err := json.Marshal(fields)
+				if err != nil {
+					logger.WithError(err).Error("access log encoding fail")
+					return
+				}
+
+				mutex.Lock()
+				//nolint:errcheck
+				config.Output.Write(append(data, '\n'))
+				mutex.Unlock()
+				return
+			}
+
 			logger = logger.WithFields(log.Map{
-				"status":   writer.Status(),
+				"status":   status,
 				"size":     writer.BytesWritten(),
 				"duration": time.Since(start),
 			})
 
+			logger = logger.WithFields(loggerAttributes(config, r, writer.Header(), capture))
+
 			switch {
-			case writer.Status() >= 500:
+			case status >= 500:
 				logger.Error("response completion fail")
-			case writer.Status() >= 400:
+			case status >= 400:
 				logger.Warn("response completion warn")
 			default:
 				logger.Info("response completion success")
@@ -87,9 +449,47 @@ func Logger(next http.Handler) http.Handler {
 	return fn(next)
 }
 
+// LoggerStream marks the request as a long-lived stream, e.g. server-sent
+// events. The opening of the stream is logged immediately. The Logger
+// middleware logs the stream on close with its lifetime instead of the
+// response duration.
+func LoggerStream(r *http.Request) {
+	state, ok := r.Context().Value(loggerCtxKey).(*loggerState)
+	if !ok {
+		return
+	}
+
+	state.mutex.Lock()
+	opening := !state.stream
+	state.stream = true
+	state.opened = time.Now()
+	state.mutex.Unlock()
+
+	if opening {
+		GetLogger(r).Info("stream opened")
+	}
+}
+
+// LoggerAddFields adds the fields to the request logger, e.g. the user ID after
+// the authentication. The fields are included in the logger returned by
+// GetLogger and in the completion line of the Logger middleware.
+func LoggerAddFields(r *http.Request, kv log.Map) {
+	if state, ok := r.Context().Value(loggerCtxKey).(*loggerState); ok {
+		state.add(kv)
+	}
+}
+
 // GetLogger returns the associated request logger
 func GetLogger(r *http.Request) log.Logger {
-	return log.GetContext(r.Context())
+	logger := log.GetContext(r.Context())
+
+	if state, ok := r.Context().Value(loggerCtxKey).(*loggerState); ok {
+		if fields := state.copy(); len(fields) > 0 {
+			logger = logger.WithFields(fields)
+		}
+	}
+
+	return logger
 }
 
 // LoggerFields returns the logger's fields
@@ -104,7 +504,7 @@ func LoggerFields(r *http.Request) log.Map {
 		return proto
 	}
 
-	return log.Map{
+	fields := log.Map{
 		"scheme":      scheme(r),
 		"host":        r.Host,
 		"url":         r.RequestURI,
@@ -113,4 +513,260 @@ func LoggerFields(r *http.Request) log.Map {
 		"remote_addr": r.RemoteAddr,
 		"request_id":  middleware.GetReqID(r.Context()),
 	}
+
+	// the trace and span IDs are set by the Tracing middleware
+	for key, value := range TracingFields(trace.SpanContextFromContext(r.Context())) {
+		fields[key] = value
+	}
+
+	return fields
+}
+
+// loggerAccept reports whether the request is logged
+func loggerAccept(config *LoggerConfig, r *http.Request, status int) bool {
+	for _, pattern := range config.Exclude {
+		if ok, _ := path.Match(pattern, r.URL.Path); ok {
+			return false
+		}
+	}
+
+	if status >= 200 && status < 300 && config.Sampling < 1 {
+		//nolint:gosec
+		return rand.Float64() < config.Sampling
+	}
+
+	return true
+}
+
+// loggerAttributes returns the optional attributes of the access log
+func loggerAttributes(config *LoggerConfig, r *http.Request, header http.Header, capture *loggerCapture) log.Map {
+	fields := log.Map{}
+
+	for _, attribute := range config.Attributes {
+		switch attribute {
+		case LoggerAttributeUserAgent:
+			fields[string(attribute)] = r.UserAgent()
+		case LoggerAttributeReferer:
+			fields[string(attribute)] = r.Referer()
+		case LoggerAttributeRoute:
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				fields[string(attribute)] = rctx.RoutePattern()
+			}
+		}
+	}
+
+	headers := func(key string, source http.Header, names []string) {
+		values := map[string]string{}
+
+		for _, name := range names {
+			if value := source.Get(name); value != "" {
+				if loggerContains(config.RedactHeaders, name) {
+					value = loggerRedacted
+				}
+
+				values[http.CanonicalHeaderKey(name)] = value
+			}
+		}
+
+		if len(values) > 0 {
+			fields[key] = values
+		}
+	}
+
+	headers("request_headers", r.Header, config.RequestHeaders)
+	headers("response_headers", header, config.ResponseHeaders)
+
+	if capture != nil {
+		body := func(key string, contentType string, buffer *loggerBuffer) {
+			if value, ok := loggerBody(config, contentType, buffer.Bytes()); ok {
+				fields[key] = value
+
+				if buffer.truncated {
+					fields[key+"_truncated"] = true
+				}
+			}
+		}
+
+		body("request_body", r.Header.Get("Content-Type"), &capture.request)
+		body("response_body", header.Get("Content-Type"), &capture.response)
+	}
+
+	return fields
+}
+
+// loggerLine formats the request in the Common or the Combined Log Format
+func loggerLine(format LoggerFormat, r *http.Request, status, size int, start time.Time) string {
+	value := func(value string) string {
+		if value == "" {
+			return "-"
+		}
+
+		return value
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	bytes := "-"
+	if size > 0 {
+		bytes = strconv.Itoa(size)
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] %q %d %s",
+		value(host),
+		value(GetPrincipal(r)),
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method+" "+r.URL.RequestURI()+" "+r.Proto,
+		status,
+		bytes,
+	)
+
+	if format == LoggerFormatCombined {
+		line += fmt.Sprintf(" %q %q", value(r.Referer()), value(r.UserAgent()))
+	}
+
+	return line + "\n"
+}
+
+const loggerRedacted = "[REDACTED]"
+
+// loggerCapture holds the captured request and response bodies
+type loggerCapture struct {
+	request  loggerBuffer
+	response loggerBuffer
+}
+
+// loggerBuffer keeps up to limit bytes of the data written to it
+type loggerBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write writes the data up to the limit. It never fails, so the response
+// writer tee is not interrupted.
+func (b *loggerBuffer) Write(data []byte) (int, error) {
+	n := len(data)
+
+	if available := b.limit - b.Len(); n > available {
+		data = data[:available]
+		b.truncated = true
+	}
+
+	b.Buffer.Write(data)
+	return n, nil
+}
+
+// loggerReader captures the request body as the handler reads it
+type loggerReader struct {
+	io.ReadCloser
+	buffer *loggerBuffer
+}
+
+// Read reads the body
+func (r *loggerReader) Read(data []byte) (int, error) {
+	n, err := r.ReadCloser.Read(data)
+	//nolint:errcheck
+	r.buffer.Write(data[:n])
+	return n, err
+}
+
+// loggerBody returns the captured body with the redacted members. It returns
+// false for the empty and the binary bodies.
+func loggerBody(config *LoggerConfig, contentType string, data []byte) (string, bool) {
+	if len(data) == 0 {
+		return "", false
+	}
+
+	mediatype, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediatype = http.DetectContentType(data)
+		mediatype, _, _ = mime.ParseMediaType(mediatype)
+	}
+
+	switch {
+	case mediatype == "application/json" || strings.HasSuffix(mediatype, "+json"):
+		if len(config.RedactJSON) == 0 {
+			return string(data), true
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		var value interface{}
+		// the truncated body cannot be redacted safely
+		if err := decoder.Decode(&value); err != nil {
+			return loggerRedacted, true
+		}
+
+		for _, path := range config.RedactJSON {
+			value = loggerRedactJSON(value, strings.Split(path, "."))
+		}
+
+		if data, err = json.Marshal(value); err != nil {
+			return loggerRedacted, true
+		}
+
+		return string(data), true
+	case mediatype == "application/x-www-form-urlencoded":
+		if len(config.RedactForm) == 0 {
+			return string(data), true
+		}
+
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return loggerRedacted, true
+		}
+
+		for key := range values {
+			if loggerContains(config.RedactForm, key) {
+				values[key] = []string{loggerRedacted}
+			}
+		}
+
+		return values.Encode(), true
+	case strings.HasPrefix(mediatype, "text/"),
+		mediatype == "application/xml",
+		mediatype == "application/x-ndjson",
+		mediatype == "application/javascript",
+		strings.HasSuffix(mediatype, "+xml"):
+		return string(data), true
+	default:
+		return "", false
+	}
+}
+
+// loggerRedactJSON redacts the members of the value at the path
+func loggerRedactJSON(value interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return loggerRedacted
+	}
+
+	switch node := value.(type) {
+	case map[string]interface{}:
+		for key, member := range node {
+			if path[0] == "*" || path[0] == key {
+				node[key] = loggerRedactJSON(member, path[1:])
+			}
+		}
+	case []interface{}:
+		for index, item := range node {
+			node[index] = loggerRedactJSON(item, path)
+		}
+	}
+
+	return value
+}
+
+// loggerContains reports whether the names contain the name case insensitively
+func loggerContains(names []string, name string) bool {
+	for _, item := range names {
+		if strings.EqualFold(item, name) {
+			return true
+		}
+	}
+
+	return false
 }
@@ -1,8 +1,14 @@
 package middleware_test
 
 import (
+	"bytes"
+	encoding "encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/onsi/gomega/gbytes"
@@ -35,4 +41,333 @@ var _ = Describe("Logger", func() {
 
 		Expect(output).To(gbytes.Say("hello"))
 	})
+
+	Context("when the request is a stream", func() {
+		It("logs the stream on close", func() {
+			router := chi.NewMux()
+			router.Use(middleware.Logger)
+
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				middleware.LoggerStream(r)
+			}
+
+			router.Mount("/", http.HandlerFunc(handler))
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+
+			Expect(output).To(gbytes.Say("stream opened"))
+			Expect(output).To(gbytes.Say("stream closed"))
+			Expect(output).To(gbytes.Say("lifetime"))
+		})
+	})
+
+	Context("when the format is combined", func() {
+		It("writes the request in the Combined Log Format", func() {
+			buffer := &bytes.Buffer{}
+
+			router := chi.NewMux()
+			router.Use(middleware.LoggerWithOption(
+				middleware.LoggerWithFormat(middleware.LoggerFormatCombined),
+				middleware.LoggerWithOutput(buffer),
+			))
+
+			router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, "hello")
+			})
+
+			request := httptest.NewRequest("GET", "http://example.com/users/1?page=2", nil)
+			request.Header.Set("User-Agent", "curl/7.0")
+
+			router.ServeHTTP(httptest.NewRecorder(), middleware.SetPrincipal(request, "john"))
+
+			Expect(buffer.String()).To(MatchRegexp(
+				`^192\.0\.2\.1 - john \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /users/1\?page=2 HTTP/1\.1" 201 5 "-" "curl/7\.0"\n$`,
+			))
+		})
+	})
+
+	Context("when the format is common", func() {
+		It("writes the request in the Common Log Format", func() {
+			buffer := &bytes.Buffer{}
+
+			handler := middleware.LoggerWithOption(
+				middleware.LoggerWithFormat(middleware.LoggerFormatCommon),
+				middleware.LoggerWithOutput(buffer),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+
+			Expect(buffer.String()).To(HavePrefix("192.0.2.1 - - ["))
+			Expect(buffer.String()).To(HaveSuffix(`] "GET / HTTP/1.1" 200 -` + "\n"))
+		})
+	})
+
+	Context("when the format is JSON", func() {
+		It("writes the request with the selected fields", func() {
+			buffer := &bytes.Buffer{}
+
+			router := chi.NewMux()
+			router.Use(middleware.LoggerWithOption(
+				middleware.LoggerWithFormat(middleware.LoggerFormatJSON),
+				middleware.LoggerWithOutput(buffer),
+				middleware.LoggerWithAttributes(middleware.LoggerAttributeRoute, middleware.LoggerAttributeReferer),
+				middleware.LoggerWithRequestHeaders("x-tenant"),
+				middleware.LoggerWithResponseHeaders("Content-Type"),
+			))
+
+			router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+			})
+
+			request := httptest.NewRequest("GET", "http://example.com/users/1", nil)
+			request.Header.Set("X-Tenant", "acme")
+			request.Header.Set("Referer", "http://example.com/")
+
+			router.ServeHTTP(httptest.NewRecorder(), request)
+
+			entry := map[string]interface{}{}
+			Expect(encoding.Unmarshal(buffer.Bytes(), &entry)).To(Succeed())
+
+			Expect(entry).To(HaveKeyWithValue("status", BeNumerically("==", 200)))
+			Expect(entry).To(HaveKeyWithValue("method", "GET"))
+			Expect(entry).To(HaveKeyWithValue("route", "/users/{id}"))
+			Expect(entry).To(HaveKeyWithValue("referer", "http://example.com/"))
+			Expect(entry).To(HaveKeyWithValue("request_headers", HaveKeyWithValue("X-Tenant", "acme")))
+			Expect(entry).To(HaveKeyWithValue("response_headers", HaveKeyWithValue("Content-Type", "text/plain")))
+			Expect(entry).To(HaveKey("duration"))
+			Expect(entry).NotTo(HaveKey("user_agent"))
+		})
+	})
+
+	Context("when the path is excluded", func() {
+		It("does not log the request", func() {
+			buffer := &bytes.Buffer{}
+
+			handler := middleware.LoggerWithOption(
+				middleware.LoggerWithFormat(middleware.LoggerFormatCommon),
+				middleware.LoggerWithOutput(buffer),
+				middleware.LoggerWithExclude("/ping", "/health/*"),
+			)(middleware.Heartbeat("/ping")(http.NotFoundHandler()))
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/ping", nil))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/health/live", nil))
+			Expect(buffer.Len()).To(BeZero())
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/users", nil))
+			Expect(buffer.String()).To(ContainSubstring(`"GET /users HTTP/1.1" 404`))
+		})
+	})
+
+	Context("when the sampling is enabled", func() {
+		It("logs the errors only", func() {
+			buffer := &bytes.Buffer{}
+			status := http.StatusOK
+
+			handler := middleware.LoggerWithOption(
+				middleware.LoggerWithFormat(middleware.LoggerFormatCommon),
+				middleware.LoggerWithOutput(buffer),
+				middleware.LoggerWithSampling(0),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+			Expect(buffer.Len()).To(BeZero())
+
+			status = http.StatusInternalServerError
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+			Expect(buffer.String()).To(ContainSubstring(" 500 "))
+		})
+	})
+
+	Context("when the body capture is enabled", func() {
+		var (
+			buffer  *bytes.Buffer
+			handler http.Handler
+			body    string
+		)
+
+		Entry := func() map[string]interface{} {
+			entry := map[string]interface{}{}
+			Expect(encoding.Unmarshal(buffer.Bytes(), &entry)).To(Succeed())
+			return entry
+		}
+
+		BeforeEach(func() {
+			buffer = &bytes.Buffer{}
+			body = ""
+
+			handler = middleware.LoggerWithOption(
+				middleware.LoggerWithFormat(middleware.LoggerFormatJSON),
+				middleware.LoggerWithOutput(buffer),
+				middleware.LoggerWithBody(128),
+				middleware.LoggerWithRedactJSON("password", "cards.number"),
+				middleware.LoggerWithRedactForm("secret"),
+				middleware.LoggerWithRequestHeaders("Authorization", "Accept"),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, err := io.ReadAll(r.Body)
+				Expect(err).NotTo(HaveOccurred())
+
+				body = string(data)
+
+				w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+				//nolint:errcheck
+				w.Write(data)
+			}))
+		})
+
+		It("captures the bodies with the redacted members", func() {
+			payload := `{"name":"john","password":"swordfish","cards":[{"number":"4111"},{"number":"5500"}]}`
+
+			request := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(payload))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Authorization", "Bearer token")
+			request.Header.Set("Accept", "application/json")
+
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+			Expect(body).To(Equal(payload))
+
+			redacted := `{"cards":[{"number":"[REDACTED]"},{"number":"[REDACTED]"}],"name":"john","password":"[REDACTED]"}`
+
+			entry := Entry()
+			Expect(entry).To(HaveKeyWithValue("request_body", redacted))
+			Expect(entry).To(HaveKeyWithValue("response_body", redacted))
+			Expect(entry).To(HaveKeyWithValue("request_headers", And(
+				HaveKeyWithValue("Authorization", "[REDACTED]"),
+				HaveKeyWithValue("Accept", "application/json"),
+			)))
+		})
+
+		It("captures the forms with the redacted fields", func() {
+			request := httptest.NewRequest("POST", "http://example.com/", strings.NewReader("name=john&secret=swordfish"))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+			Expect(Entry()).To(HaveKeyWithValue("request_body", "name=john&secret=%5BREDACTED%5D"))
+		})
+
+		It("truncates the bodies at the limit", func() {
+			payload := strings.Repeat("a", 200)
+
+			request := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(payload))
+			request.Header.Set("Content-Type", "text/plain")
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			Expect(body).To(Equal(payload))
+			Expect(recorder.Body.String()).To(Equal(payload))
+
+			entry := Entry()
+			Expect(entry).To(HaveKeyWithValue("request_body", payload[:128]))
+			Expect(entry).To(HaveKeyWithValue("request_body_truncated", true))
+		})
+
+		It("redacts the truncated JSON bodies", func() {
+			payload := `{"password":"` + strings.Repeat("a", 200) + `"}`
+
+			request := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(payload))
+			request.Header.Set("Content-Type", "application/json")
+
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+			Expect(Entry()).To(HaveKeyWithValue("request_body", "[REDACTED]"))
+		})
+
+		It("skips the binary bodies", func() {
+			request := httptest.NewRequest("POST", "http://example.com/", strings.NewReader("\x89PNG\r\n"))
+			request.Header.Set("Content-Type", "image/png")
+
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			entry := Entry()
+			Expect(entry).NotTo(HaveKey("request_body"))
+			Expect(entry).NotTo(HaveKey("response_body"))
+		})
+	})
+
+	Context("when the handler adds fields", func() {
+		It("includes the fields in the completion line", func() {
+			router := chi.NewMux()
+			router.Use(middleware.Logger)
+
+			router.Get("/", func(w http.ResponseWriter, r *http.Request) {
+				middleware.LoggerAddFields(r, log.Map{"user_id": "007"})
+				middleware.GetLogger(r).Info("authenticated")
+			})
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+
+			Expect(output).To(gbytes.Say(`"message":"authenticated".*"user_id":"007"`))
+			Expect(output).To(gbytes.Say(`"message":"response completion success".*"user_id":"007"`))
+		})
+	})
+
+	Context("when the fields are derived from the request", func() {
+		It("includes the route pattern and the principal", func() {
+			buffer := &bytes.Buffer{}
+
+			router := chi.NewMux()
+			router.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					next.ServeHTTP(w, middleware.SetPrincipal(r, "john"))
+				})
+			})
+			router.Use(middleware.LoggerWithOption(
+				middleware.LoggerWithFormat(middleware.LoggerFormatJSON),
+				middleware.LoggerWithOutput(buffer),
+				middleware.LoggerRequestFields,
+			))
+
+			router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/users/1", nil))
+
+			entry := map[string]interface{}{}
+			Expect(encoding.Unmarshal(buffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry).To(HaveKeyWithValue("route", "/users/{id}"))
+			Expect(entry).To(HaveKeyWithValue("principal", "john"))
+		})
+	})
+
+	Context("when the requests are concurrent", func() {
+		It("does not mix the fields of the requests", func() {
+			var (
+				buffer = &bytes.Buffer{}
+				group  sync.WaitGroup
+			)
+
+			handler := middleware.LoggerWithOption(
+				middleware.LoggerWithFormat(middleware.LoggerFormatJSON),
+				middleware.LoggerWithOutput(buffer),
+				middleware.LoggerOptionWithFields(log.Map{"app": "test"}),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			for index := 0; index < 20; index++ {
+				group.Add(1)
+
+				go func(index int) {
+					defer GinkgoRecover()
+					defer group.Done()
+
+					path := fmt.Sprintf("/users/%d", index)
+					handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+				}(index)
+			}
+
+			group.Wait()
+
+			lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+			Expect(lines).To(HaveLen(20))
+
+			urls := []string{}
+			for _, line := range lines {
+				entry := map[string]interface{}{}
+				Expect(encoding.Unmarshal([]byte(line), &entry)).To(Succeed())
+				urls = append(urls, entry["url"].(string))
+			}
+
+			for index := 0; index < 20; index++ {
+				Expect(urls).To(ContainElement(fmt.Sprintf("/users/%d", index)))
+			}
+		})
+	})
 })
@@ -8,44 +8,183 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
+	"github.com/go-playground/errors/v5"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-// Metrics enables metrics for each request
-func Metrics(next http.Handler) http.Handler {
-	labels := []string{
-		"id",
-		"code",
-		"handler",
-		"method",
-	}
-
-	reqTotal := promauto.NewCounterVec(prometheus.CounterOpts{
-		Subsystem: "http",
-		Name:      "requests_total",
-		Help:      "Total number of HTTP requests made",
-	}, labels[1:])
-
-	reqTime := promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Subsystem: "http",
-		Name:      "request_duration_seconds",
-		Help:      "The HTTP response duration time",
-		Buckets:   prometheus.DefBuckets,
-	}, labels)
-
-	hn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		writer := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
-		next.ServeHTTP(writer, r)
-		Status(r, writer.Status())
-	})
+// MetricsConfig represents the configuration of the Metrics middleware
+type MetricsConfig struct {
+	// Registerer registers the collectors
+	Registerer prometheus.Registerer
+	// Namespace is the namespace of the metrics
+	Namespace string
+	// Subsystem is the subsystem of the metrics
+	Subsystem string
+	// Buckets are the buckets of the duration histogram
+	Buckets []float64
+	// SizeBuckets are the buckets of the request and response size histograms
+	SizeBuckets []float64
+	// ConstLabels are the labels added to all metrics
+	ConstLabels prometheus.Labels
+	// Labels are the labels of the metrics. The allowed labels are code,
+	// handler and method.
+	Labels []string
+}
+
+// MetricsOption represents a metrics option
+type MetricsOption func(config *MetricsConfig)
+
+// MetricsWithRegisterer registers the collectors with the given registerer
+func MetricsWithRegisterer(registerer prometheus.Registerer) MetricsOption {
+	return func(config *MetricsConfig) {
+		config.Registerer = registerer
+	}
+}
+
+// MetricsWithNamespace sets the namespace of the metrics
+func MetricsWithNamespace(namespace string) MetricsOption {
+	return func(config *MetricsConfig) {
+		config.Namespace = namespace
+	}
+}
+
+// MetricsWithSubsystem sets the subsystem of the metrics
+func MetricsWithSubsystem(subsystem string) MetricsOption {
+	return func(config *MetricsConfig) {
+		config.Subsystem = subsystem
+	}
+}
+
+// MetricsWithBuckets sets the buckets of the duration histogram
+func MetricsWithBuckets(buckets []float64) MetricsOption {
+	return func(config *MetricsConfig) {
+		config.Buckets = buckets
+	}
+}
+
+// MetricsWithSizeBuckets sets the buckets of the size histograms
+func MetricsWithSizeBuckets(buckets []float64) MetricsOption {
+	return func(config *MetricsConfig) {
+		config.SizeBuckets = buckets
+	}
+}
+
+// MetricsWithConstLabels adds the labels to all metrics
+func MetricsWithConstLabels(labels prometheus.Labels) MetricsOption {
+	return func(config *MetricsConfig) {
+		config.ConstLabels = labels
+	}
+}
+
+// MetricsWithLabels sets the labels of the metrics. The labels that are not
+// allowed are ignored.
+func MetricsWithLabels(labels ...string) MetricsOption {
+	return func(config *MetricsConfig) {
+		config.Labels = labels
+	}
+}
+
+// MetricsWithOption returns a middleware that collects the count, the
+// duration and the request and response sizes of the requests as well as the
+// number of requests in flight. The collectors that are registered already
+// are reused, so the middleware can be used by many routers.
+func MetricsWithOption(options ...MetricsOption) func(http.Handler) http.Handler {
+	config := &MetricsConfig{
+		Registerer:  prometheus.DefaultRegisterer,
+		Subsystem:   "http",
+		Buckets:     prometheus.DefBuckets,
+		SizeBuckets: prometheus.ExponentialBuckets(100, 10, 6),
+		Labels:      []string{"code", "handler", "method"},
+	}
+
+	for _, option := range options {
+		option(config)
+	}
+
+	labels := []string{}
+
+	for _, label := range config.Labels {
+		switch label {
+		case "code", "handler", "method":
+			labels = append(labels, label)
+		}
+	}
+
+	histogram := func(name, help string, buckets []float64) *prometheus.HistogramVec {
+		collector := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   config.Namespace,
+			Subsystem:   config.Subsystem,
+			Name:        name,
+			Help:        help,
+			Buckets:     buckets,
+			ConstLabels: config.ConstLabels,
+		}, labels)
+
+		return metricsRegister(config.Registerer, collector).(*prometheus.HistogramVec)
+	}
+
+	reqTotal := metricsRegister(config.Registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "requests_total",
+		Help:        "Total number of HTTP requests made",
+		ConstLabels: config.ConstLabels,
+	}, labels)).(*prometheus.CounterVec)
+
+	reqFlight := metricsRegister(config.Registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "requests_in_flight",
+		Help:        "The number of HTTP requests in flight",
+		ConstLabels: config.ConstLabels,
+	})).(prometheus.Gauge)
+
+	var (
+		reqTime = histogram("request_duration_seconds", "The HTTP response duration time", config.Buckets)
+		reqSize = histogram("request_size_bytes", "The HTTP request size", config.SizeBuckets)
+		resSize = histogram("response_size_bytes", "The HTTP response size", config.SizeBuckets)
+	)
+
+	mw := func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			reqFlight.Inc()
+			defer reqFlight.Dec()
 
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		handler := InstrumentHandlerCounter(reqTotal, InstrumentHandlerDuration(reqTime, hn))
-		handler.ServeHTTP(w, r)
+			var (
+				writer = middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+				start  = time.Now()
+			)
+
+			next.ServeHTTP(writer, r)
+
+			status := writer.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			values := instrumentLabels(r, status, labels...)
+
+			size := r.ContentLength
+			if size < 0 {
+				size = 0
+			}
+
+			reqTotal.With(values).Inc()
+			reqTime.With(values).Observe(time.Since(start).Seconds())
+			reqSize.With(values).Observe(float64(size))
+			resSize.With(values).Observe(float64(writer.BytesWritten()))
+		}
+
+		return http.HandlerFunc(fn)
 	}
 
-	return http.HandlerFunc(fn)
+	return mw
+}
+
+// Metrics enables metrics for each request
+func Metrics(next http.Handler) http.Handler {
+	fn := MetricsWithOption()
+	return fn(next)
 }
 
 // InstrumentHandlerCounter is a middleware that wraps the provided http.Handler
@@ -89,46 +228,86 @@ func InstrumentHandlerDuration(obs prometheus.ObserverVec, next http.Handler) ht
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		now := time.Now()
 		next.ServeHTTP(w, r)
-		obs.With(InstrumentLabels(r, "id", "code")).Observe(time.Since(now).Seconds())
+		obs.With(InstrumentLabels(r, "code")).Observe(time.Since(now).Seconds())
 	})
 }
 
-// InstrumentLabels returns the instrument labels
+// InstrumentLabels returns the instrument labels. The handler and method
+// labels are always present.
 func InstrumentLabels(r *http.Request, keys ...string) prometheus.Labels {
-	ctx := r.Context()
-	routeCtx := chi.RouteContext(ctx)
+	status, ok := r.Context().Value(render.StatusCtxKey).(int)
+	if !ok {
+		status = 0
+	}
+
+	labels := instrumentLabels(r, status, keys...)
+	labels["handler"], labels["method"] = instrumentRoute(r)
+
+	return labels
+}
+
+// instrumentLabels returns the labels with the given keys
+func instrumentLabels(r *http.Request, status int, keys ...string) prometheus.Labels {
+	var (
+		labels          = prometheus.Labels{}
+		pattern, method = instrumentRoute(r)
+	)
+
+	for _, key := range keys {
+		switch key {
+		case "id":
+			labels[key] = middleware.GetReqID(r.Context())
+		case "code":
+			labels[key] = fmt.Sprintf("%v", status)
+		case "handler":
+			labels[key] = pattern
+		case "method":
+			labels[key] = method
+		}
+	}
+
+	return labels
+}
+
+// instrumentUnmatched is the handler label of the requests that do not match
+// a route. The path is not used, so the cardinality of the label is bounded.
+const instrumentUnmatched = "unmatched"
+
+// instrumentRoute returns the route pattern and the method of the request
+func instrumentRoute(r *http.Request) (string, string) {
+	var (
+		pattern = ""
+		method  = ""
+	)
+
+	if routeCtx := chi.RouteContext(r.Context()); routeCtx != nil {
+		pattern = routeCtx.RoutePattern()
+		method = routeCtx.RouteMethod
+	}
 
-	pattern := routeCtx.RoutePattern()
 	if pattern == "" {
-		pattern = r.RequestURI
+		pattern = instrumentUnmatched
 	}
 
-	method := routeCtx.RouteMethod
 	if method == "" {
 		method = r.Method
 	}
 
-	labels := prometheus.Labels{
-		"handler": pattern,
-		"method":  method,
-	}
+	return pattern, method
+}
 
-	for _, key := range keys {
-		value := ""
+// metricsRegister registers the collector. The collector that is registered
+// already is returned instead of the given one.
+func metricsRegister(registerer prometheus.Registerer, collector prometheus.Collector) prometheus.Collector {
+	if err := registerer.Register(collector); err != nil {
+		var rerr prometheus.AlreadyRegisteredError
 
-		switch key {
-		case "id":
-			value = middleware.GetReqID(ctx)
-		case "code":
-			status, ok := r.Context().Value(render.StatusCtxKey).(int)
-			if !ok {
-				status = 0
-			}
-			value = fmt.Sprintf("%v", status)
+		if errors.As(err, &rerr) {
+			return rerr.ExistingCollector
 		}
 
-		labels[key] = value
+		panic(err)
 	}
 
-	return labels
+	return collector
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/phogolabs/rest/middleware"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -29,4 +30,102 @@ var _ = Describe("Metrics", func() {
 		Expect(err).To(BeNil())
 		Expect(data).NotTo(HaveLen(0))
 	})
+
+	It("can be used by many routers", func() {
+		for index := 0; index < 2; index++ {
+			router := chi.NewMux()
+			Expect(func() { router.Use(middleware.Metrics) }).NotTo(Panic())
+		}
+	})
+})
+
+var _ = Describe("MetricsWithOption", func() {
+	var registry *prometheus.Registry
+
+	BeforeEach(func() {
+		registry = prometheus.NewRegistry()
+	})
+
+	It("writes the metrics to the registry", func() {
+		router := chi.NewMux()
+		router.Use(middleware.MetricsWithOption(
+			middleware.MetricsWithRegisterer(registry),
+			middleware.MetricsWithNamespace("acme"),
+			middleware.MetricsWithSubsystem("api"),
+			middleware.MetricsWithBuckets([]float64{0.1, 1}),
+			middleware.MetricsWithConstLabels(prometheus.Labels{"service": "users"}),
+			middleware.MetricsWithLabels("code", "handler", "id"),
+		))
+
+		router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "hello")
+		})
+
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/users/1", nil))
+
+		families, err := registry.Gather()
+		Expect(err).To(BeNil())
+
+		metrics := map[string]*dto.MetricFamily{}
+		for _, family := range families {
+			metrics[family.GetName()] = family
+		}
+
+		Expect(metrics).To(HaveKey("acme_api_requests_total"))
+		Expect(metrics).To(HaveKey("acme_api_request_duration_seconds"))
+		Expect(metrics).To(HaveKey("acme_api_request_size_bytes"))
+		Expect(metrics).To(HaveKey("acme_api_response_size_bytes"))
+		Expect(metrics).To(HaveKey("acme_api_requests_in_flight"))
+
+		labels := map[string]string{}
+		for _, pair := range metrics["acme_api_requests_total"].GetMetric()[0].GetLabel() {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+
+		Expect(labels).To(Equal(map[string]string{
+			"code":    "200",
+			"handler": "/users/{id}",
+			"service": "users",
+		}))
+
+		histogram := metrics["acme_api_request_duration_seconds"].GetMetric()[0].GetHistogram()
+		Expect(histogram.GetBucket()).To(HaveLen(2))
+
+		size := metrics["acme_api_response_size_bytes"].GetMetric()[0].GetHistogram()
+		Expect(size.GetSampleSum()).To(BeEquivalentTo(6))
+	})
+
+	Context("when the request does not match a route", func() {
+		It("labels the request as unmatched", func() {
+			router := chi.NewMux()
+			router.Use(middleware.MetricsWithOption(
+				middleware.MetricsWithRegisterer(registry),
+				middleware.MetricsWithLabels("handler"),
+			))
+
+			router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, "hello")
+			})
+
+			for _, path := range []string{"/accounts/1", "/accounts/2"} {
+				router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com"+path, nil))
+			}
+
+			families, err := registry.Gather()
+			Expect(err).To(BeNil())
+
+			for _, family := range families {
+				if family.GetName() != "http_requests_total" {
+					continue
+				}
+
+				Expect(family.GetMetric()).To(HaveLen(1))
+				Expect(family.GetMetric()[0].GetLabel()[0].GetValue()).To(Equal("unmatched"))
+				Expect(family.GetMetric()[0].GetCounter().GetValue()).To(BeEquivalentTo(2))
+				return
+			}
+
+			Fail("http_requests_total is not registered")
+		})
+	})
 })
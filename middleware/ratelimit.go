@@ -0,0 +1,357 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/errors/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RateLimitResult represents the decision of a rate limiter
+type RateLimitResult struct {
+	// Allowed reports whether the request is allowed
+	Allowed bool
+	// Limit is the number of requests allowed in the period
+	Limit int
+	// Remaining is the number of requests that can be made immediately
+	Remaining int
+	// Reset is the time until the quota is fully restored
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed
+	RetryAfter time.Duration
+}
+
+// RateLimiter decides whether the requests with a given key are allowed
+type RateLimiter interface {
+	Allow(key string) RateLimitResult
+}
+
+// RateLimitKeyFunc returns the key of the rate limit of a request. The request
+// is not limited if the key is empty.
+type RateLimitKeyFunc func(r *http.Request) string
+
+var (
+	// RateLimitByIP limits the requests by the IP address of the client. It
+	// should be used with the RealIP middleware behind a proxy.
+	RateLimitByIP RateLimitKeyFunc = func(r *http.Request) string {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+
+		return host
+	}
+
+	// RateLimitByRequestID limits the requests by their request ID. It should
+	// be used after the RequestID middleware, which keeps the X-Request-Id
+	// header sent by the client, so the clients that reuse their ID are
+	// limited together.
+	RateLimitByRequestID RateLimitKeyFunc = func(r *http.Request) string {
+		return middleware.GetReqID(r.Context())
+	}
+
+	// RateLimitByPrincipal limits the requests by the authenticated principal
+	// set by SetPrincipal
+	RateLimitByPrincipal RateLimitKeyFunc = GetPrincipal
+)
+
+// RateLimitWithOption returns a middleware that limits the requests by the key
+// returned by the key function. The RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers are set on every response. It responds with 429 Too
+// Many Requests and the Retry-After header when the limit is exceeded. The
+// decisions are counted by the rate_limit_requests_total metric, which is
+// registered with the registerer, the namespace, the subsystem and the const
+// labels of the metrics options. The counter that is registered already is
+// reused.
+func RateLimitWithOption(limiter RateLimiter, key RateLimitKeyFunc, options ...MetricsOption) func(http.Handler) http.Handler {
+	config := &MetricsConfig{
+		Registerer: prometheus.DefaultRegisterer,
+		Subsystem:  "http",
+	}
+
+	for _, option := range options {
+		option(config)
+	}
+
+	counter := metricsRegister(config.Registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   config.Namespace,
+		Subsystem:   config.Subsystem,
+		Name:        "rate_limit_requests_total",
+		Help:        "Total number of HTTP requests checked by the rate limiter",
+		ConstLabels: config.ConstLabels,
+	}, []string{"method", "result"})).(*prometheus.CounterVec)
+
+	mw := func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			name := key(r)
+
+			if name == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result := limiter.Allow(name)
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", rateLimitSeconds(result.Reset))
+
+			if !result.Allowed {
+				counter.WithLabelValues(r.Method, "limited").Inc()
+
+				header.Set("Retry-After", rateLimitSeconds(result.RetryAfter))
+
+				err := errors.New("rate limit exceeded").
+					AddTag("status", http.StatusTooManyRequests)
+
+				ErrorResponder(w, r, err)
+				return
+			}
+
+			counter.WithLabelValues(r.Method, "allowed").Inc()
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return mw
+}
+
+// RateLimit returns a middleware that limits the requests by the key returned
+// by the key function. The decisions are counted by the
+// http_rate_limit_requests_total metric.
+func RateLimit(limiter RateLimiter, key RateLimitKeyFunc) func(http.Handler) http.Handler {
+	return RateLimitWithOption(limiter, key)
+}
+
+// TokenBucketLimiter is a rate limiter that allows bursts of up to limit
+// requests and refills the bucket of each key at a rate of limit requests per
+// period
+type TokenBucketLimiter struct {
+	mutex   sync.Mutex
+	limit   int
+	period  time.Duration
+	buckets map[string]*tokenBucket
+	pruned  time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewTokenBucketLimiter creates a new token bucket rate limiter. It panics if
+// the limit or the period is not positive.
+func NewTokenBucketLimiter(limit int, period time.Duration) *TokenBucketLimiter {
+	rateLimitCheck(limit, period)
+
+	return &TokenBucketLimiter{
+		limit:   limit,
+		period:  period,
+		buckets: make(map[string]*tokenBucket),
+		pruned:  time.Now(),
+	}
+}
+
+// Allow reports whether a request with the given key is allowed
+func (l *TokenBucketLimiter) Allow(key string) RateLimitResult {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var (
+		now  = time.Now()
+		rate = float64(l.limit) / l.period.Seconds()
+	)
+
+	l.prune(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.limit), updated: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(float64(l.limit), bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+
+	result := RateLimitResult{
+		Limit: l.limit,
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = rateLimitDuration((1 - bucket.tokens) / rate)
+	}
+
+	result.Remaining = int(bucket.tokens)
+	result.Reset = rateLimitDuration((float64(l.limit) - bucket.tokens) / rate)
+
+	return result
+}
+
+// prune removes the buckets that are full again
+func (l *TokenBucketLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < l.period {
+		return
+	}
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= l.period {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.pruned = now
+}
+
+// SlidingWindowLimiter is a rate limiter that allows up to limit requests of
+// each key in a window that slides over time. The count of the previous fixed
+// window is weighted by its overlap with the sliding window.
+type SlidingWindowLimiter struct {
+	mutex   sync.Mutex
+	limit   int
+	window  time.Duration
+	windows map[string]*slidingWindow
+	pruned  time.Time
+}
+
+type slidingWindow struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+// NewSlidingWindowLimiter creates a new sliding window rate limiter. It panics
+// if the limit or the window is not positive.
+func NewSlidingWindowLimiter(limit int, window time.Duration) *SlidingWindowLimiter {
+	rateLimitCheck(limit, window)
+
+	return &SlidingWindowLimiter{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]*slidingWindow),
+		pruned:  time.Now(),
+	}
+}
+
+// Allow reports whether a request with the given key is allowed
+func (l *SlidingWindowLimiter) Allow(key string) RateLimitResult {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var (
+		now   = time.Now()
+		start = now.Truncate(l.window)
+	)
+
+	l.prune(start)
+
+	window, ok := l.windows[key]
+	if !ok {
+		window = &slidingWindow{start: start}
+		l.windows[key] = window
+	}
+
+	if !window.start.Equal(start) {
+		previous := 0
+
+		// the current window becomes the previous one
+		if start.Sub(window.start) == l.window {
+			previous = window.current
+		}
+
+		window.start = start
+		window.previous = previous
+		window.current = 0
+	}
+
+	var (
+		elapsed = now.Sub(start)
+		weight  = 1 - elapsed.Seconds()/l.window.Seconds()
+		count   = float64(window.previous)*weight + float64(window.current)
+	)
+
+	result := RateLimitResult{
+		Limit: l.limit,
+		Reset: start.Add(l.window).Sub(now),
+	}
+
+	if count+1 <= float64(l.limit) {
+		window.current++
+		count++
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.retry(window, elapsed)
+	}
+
+	if remaining := int(float64(l.limit) - count); remaining > 0 {
+		result.Remaining = remaining
+	}
+
+	return result
+}
+
+// retry returns the time until the weighted count allows one more request
+func (l *SlidingWindowLimiter) retry(window *slidingWindow, elapsed time.Duration) time.Duration {
+	if window.current+1 > l.limit || window.previous == 0 {
+		// the next window starts without the current requests being weighted
+		return l.window - elapsed
+	}
+
+	// previous * (1 - (elapsed + t) / window) + current + 1 <= limit
+	ratio := 1 - float64(l.limit-window.current-1)/float64(window.previous)
+	wait := time.Duration(ratio*float64(l.window)) - elapsed
+
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait
+}
+
+// prune removes the windows that do not weight anymore
+func (l *SlidingWindowLimiter) prune(start time.Time) {
+	if start.Sub(l.pruned) < l.window {
+		return
+	}
+
+	for key, window := range l.windows {
+		if start.Sub(window.start) > l.window {
+			delete(l.windows, key)
+		}
+	}
+
+	l.pruned = start
+}
+
+// rateLimitCheck panics if the limit or the period is not positive, as the
+// rate would not be finite
+func rateLimitCheck(limit int, period time.Duration) {
+	if limit <= 0 {
+		panic(fmt.Sprintf("rate limit: non-positive limit %d", limit))
+	}
+
+	if period <= 0 {
+		panic(fmt.Sprintf("rate limit: non-positive period %v", period))
+	}
+}
+
+func rateLimitDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// rateLimitSeconds returns the duration in whole seconds rounded up
+func rateLimitSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
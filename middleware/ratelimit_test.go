@@ -0,0 +1,175 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/phogolabs/rest/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimit", func() {
+	var handler http.Handler
+
+	NewRequest := func(addr string) *http.Request {
+		request := httptest.NewRequest("GET", "http://example.com/", nil)
+		request.RemoteAddr = addr
+		return request
+	}
+
+	BeforeEach(func() {
+		limiter := middleware.NewTokenBucketLimiter(2, time.Hour)
+
+		handler = middleware.RateLimit(limiter, middleware.RateLimitByIP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	})
+
+	It("limits the requests of each client", func() {
+		for index := 0; index < 2; index++ {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, NewRequest("192.0.2.1:1234"))
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("RateLimit-Limit")).To(Equal("2"))
+			Expect(recorder.Header().Get("RateLimit-Remaining")).To(Equal(strconv.Itoa(1 - index)))
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, NewRequest("192.0.2.1:4321"))
+
+		Expect(recorder.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(recorder.Header().Get("RateLimit-Remaining")).To(Equal("0"))
+		Expect(recorder.Header().Get("Retry-After")).To(Equal("1800"))
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, NewRequest("192.0.2.2:1234"))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+	})
+
+	It("counts the decisions", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), NewRequest("192.0.2.3:1234"))
+
+		data, err := prometheus.DefaultGatherer.Gather()
+		Expect(err).NotTo(HaveOccurred())
+
+		names := []string{}
+		for _, family := range data {
+			names = append(names, family.GetName())
+		}
+
+		Expect(names).To(ContainElement("http_rate_limit_requests_total"))
+	})
+
+	Context("when the metrics options are set", func() {
+		It("registers the counter with the registerer", func() {
+			registry := prometheus.NewRegistry()
+
+			for index := 0; index < 2; index++ {
+				middleware.RateLimitWithOption(
+					middleware.NewTokenBucketLimiter(1, time.Hour),
+					middleware.RateLimitByIP,
+					middleware.MetricsWithRegisterer(registry),
+					middleware.MetricsWithNamespace("api"),
+				)(handler).ServeHTTP(httptest.NewRecorder(), NewRequest("192.0.2.4:1234"))
+			}
+
+			data, err := registry.Gather()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(HaveLen(1))
+			Expect(data[0].GetName()).To(Equal("api_http_rate_limit_requests_total"))
+		})
+	})
+
+	Context("when the key is empty", func() {
+		It("does not limit the requests", func() {
+			handler = middleware.RateLimit(middleware.NewTokenBucketLimiter(1, time.Hour), middleware.RateLimitByPrincipal)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			for index := 0; index < 2; index++ {
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, NewRequest("192.0.2.1:1234"))
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				Expect(recorder.Header().Get("RateLimit-Limit")).To(BeEmpty())
+			}
+		})
+	})
+
+	Context("when the request ID is sent by the client", func() {
+		It("limits the requests of the request ID", func() {
+			limiter := middleware.NewTokenBucketLimiter(1, time.Hour)
+
+			handler = middleware.RequestID(middleware.RateLimit(limiter, middleware.RateLimitByRequestID)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+
+			for _, code := range []int{http.StatusOK, http.StatusTooManyRequests} {
+				request := NewRequest("192.0.2.1:1234")
+				request.Header.Set("X-Request-Id", "batch-1")
+
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, request)
+				Expect(recorder.Code).To(Equal(code))
+			}
+		})
+	})
+
+	Context("when the principal is set", func() {
+		It("limits the requests of the principal", func() {
+			limiter := middleware.NewTokenBucketLimiter(1, time.Hour)
+
+			handler = middleware.RateLimit(limiter, middleware.RateLimitByPrincipal)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, middleware.SetPrincipal(NewRequest("192.0.2.1:1234"), "john"))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, middleware.SetPrincipal(NewRequest("192.0.2.2:1234"), "john"))
+			Expect(recorder.Code).To(Equal(http.StatusTooManyRequests))
+		})
+	})
+})
+
+var _ = Describe("TokenBucketLimiter", func() {
+	Context("when the limit is not positive", func() {
+		It("panics", func() {
+			Expect(func() { middleware.NewTokenBucketLimiter(0, time.Hour) }).To(Panic())
+			Expect(func() { middleware.NewTokenBucketLimiter(1, 0) }).To(Panic())
+		})
+	})
+})
+
+var _ = Describe("SlidingWindowLimiter", func() {
+	It("limits the requests in the window", func() {
+		limiter := middleware.NewSlidingWindowLimiter(3, time.Hour)
+
+		for index := 0; index < 3; index++ {
+			result := limiter.Allow("john")
+			Expect(result.Allowed).To(BeTrue())
+			Expect(result.Remaining).To(Equal(2 - index))
+		}
+
+		result := limiter.Allow("john")
+		Expect(result.Allowed).To(BeFalse())
+		Expect(result.RetryAfter).To(BeNumerically(">", 0))
+		Expect(result.RetryAfter).To(BeNumerically("<=", time.Hour))
+
+		Expect(limiter.Allow("jack").Allowed).To(BeTrue())
+	})
+
+	Context("when the limit is not positive", func() {
+		It("panics", func() {
+			Expect(func() { middleware.NewSlidingWindowLimiter(-1, time.Hour) }).To(Panic())
+		})
+	})
+})
@@ -4,33 +4,117 @@ import (
 	"net/http"
 	"runtime/debug"
 
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/errors/v5"
 	"github.com/phogolabs/log"
 )
 
-// Recoverer is a middleware that recovers from panics, logs the panic (and a
-// backtrace), and returns a HTTP 500 (Internal Server Error) status if
-// possible. Recoverer prints a request ID if one is provided.
-//
-// Alternatively, look at https://github.com/pressly/lg middleware pkgs.
-func Recoverer(next http.Handler) http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		logger := GetLogger(r)
+// RecovererReporter reports a recovered panic, e.g. to an error tracker
+type RecovererReporter func(r *http.Request, cause interface{}, stack []byte)
+
+// RecovererConfig represents the configuration of the Recoverer middleware
+type RecovererConfig struct {
+	// Reporter reports the recovered panics
+	Reporter RecovererReporter
+	// Development includes the cause and the stack trace of the panic in the
+	// response body
+	Development bool
+}
+
+// RecovererOption represents a recoverer option
+type RecovererOption func(config *RecovererConfig)
+
+// RecovererWithReporter sets the reporter of the recovered panics
+func RecovererWithReporter(reporter RecovererReporter) RecovererOption {
+	return func(config *RecovererConfig) {
+		config.Reporter = reporter
+	}
+}
+
+// RecovererWithDevelopment includes the cause and the stack trace of the panic
+// in the response body. It should not be used in production.
+func RecovererWithDevelopment() RecovererOption {
+	return func(config *RecovererConfig) {
+		config.Development = true
+	}
+}
 
-		defer func() {
-			if rvr := recover(); rvr != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+// RecovererWithOption returns a middleware that recovers from panics and
+// responds with 500 Internal Server Error through the ErrorResponder, which
+// logs the panic (and a backtrace). The response body does not contain the
+// cause of the panic unless the development mode is on. The response is left
+// as it is and the panic is logged if the handler has started writing it
+// already. The http.ErrAbortHandler panics are propagated
+// to the server, so the connection is aborted.
+func RecovererWithOption(options ...RecovererOption) func(http.Handler) http.Handler {
+	config := &RecovererConfig{}
 
-				fields := log.Map{
-					"cause": rvr,
-					"stack": string(debug.Stack()),
+	for _, option := range options {
+		option(config)
+	}
+
+	mw := func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			writer := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			defer func() {
+				rvr := recover()
+
+				if rvr == nil {
+					return
 				}
 
-				logger.WithFields(fields).Alert("panic")
-			}
-		}()
+				if rvr == http.ErrAbortHandler {
+					panic(rvr)
+				}
 
-		next.ServeHTTP(w, r)
+				stack := debug.Stack()
+
+				if config.Reporter != nil {
+					config.Reporter(r, rvr, stack)
+				}
+
+				// the status code and a part of the body are sent already
+				if writer.Status() != 0 {
+					fields := log.Map{
+						"cause":   rvr,
+						"stack":   string(stack),
+						"written": true,
+					}
+
+					GetLogger(r).WithFields(fields).Alert("panic")
+					return
+				}
+
+				// the error is logged by the ErrorResponder
+				err := errors.Newf("panic: %v", rvr).
+					AddTag("status", http.StatusInternalServerError)
+
+				if config.Development {
+					err = err.AddTag(ProblemExtensionPrefix+"stack", string(stack))
+				} else {
+					// the cause of the panic is not exposed to the client
+					err = err.AddTag("detail", "").AddTag("stack", string(stack))
+				}
+
+				ErrorResponder(writer, r, err)
+			}()
+
+			next.ServeHTTP(writer, r)
+		}
+
+		return http.HandlerFunc(fn)
 	}
 
-	return http.HandlerFunc(fn)
+	return mw
+}
+
+// Recoverer is a middleware that recovers from panics, logs the panic (and a
+// backtrace), and returns a HTTP 500 (Internal Server Error) status if
+// possible. Recoverer prints a request ID if one is provided.
+//
+// Alternatively, look at https://github.com/pressly/lg middleware pkgs.
+func Recoverer(next http.Handler) http.Handler {
+	fn := RecovererWithOption()
+	return fn(next)
 }
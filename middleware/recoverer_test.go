@@ -1,8 +1,10 @@
 package middleware_test
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/onsi/gomega/gbytes"
@@ -35,4 +37,69 @@ var _ = Describe("Recoverer", func() {
 
 		Expect(output).To(gbytes.Say("hello"))
 	})
+	It("responds with 500", func() {
+		handler := middleware.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("hello")
+		}))
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/", nil))
+
+		Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+		Expect(recorder.Body.String()).To(Equal(http.StatusText(http.StatusInternalServerError) + "\n"))
+	})
+
+	It("logs the panic once", func() {
+		handler := middleware.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("hello")
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+		Expect(strings.Count(string(output.Contents()), "panic: hello")).To(Equal(1))
+	})
+
+	It("reports the panic", func() {
+		var cause interface{}
+
+		reporter := func(r *http.Request, rvr interface{}, stack []byte) {
+			cause = rvr
+			Expect(stack).NotTo(BeEmpty())
+		}
+
+		handler := middleware.RecovererWithOption(middleware.RecovererWithReporter(reporter))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("hello")
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+		Expect(cause).To(Equal("hello"))
+	})
+
+	Context("when the response is written", func() {
+		It("does not write the status again", func() {
+			handler := middleware.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				fmt.Fprint(w, "partial")
+				panic("hello")
+			}))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/", nil))
+
+			Expect(recorder.Code).To(Equal(http.StatusAccepted))
+			Expect(recorder.Body.String()).To(Equal("partial"))
+			Expect(output).To(gbytes.Say(`"written":true`))
+		})
+	})
+
+	Context("when the handler is aborted", func() {
+		It("panics again", func() {
+			handler := middleware.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic(http.ErrAbortHandler)
+			}))
+
+			Expect(func() {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+			}).To(PanicWith(http.ErrAbortHandler))
+		})
+	})
 })
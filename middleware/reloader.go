@@ -1,47 +1,220 @@
 package middleware
 
 import (
+	"bufio"
 	"bytes"
-	"fmt"
 	"io"
+	"io/fs"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	hub "github.com/DATA-DOG/golang-websocket-hub"
 	"github.com/fsnotify/fsnotify"
+	"github.com/gorilla/websocket"
 	"github.com/phogolabs/log"
 )
 
+// ReloaderConfig represents the configuration of the Reloader
+type ReloaderConfig struct {
+	// Paths are the directories watched recursively
+	Paths []string
+	// Include are the glob patterns of the files that trigger a reload. All
+	// files trigger a reload if it is empty.
+	Include []string
+	// Exclude are the glob patterns of the files and the directories that are
+	// ignored
+	Exclude []string
+	// Delay is the time to wait for more changes before the reload
+	Delay time.Duration
+}
+
+// ReloaderOption represents a reloader option
+type ReloaderOption func(config *ReloaderConfig)
+
+// ReloaderWithPaths sets the directories that are watched recursively
+func ReloaderWithPaths(paths ...string) ReloaderOption {
+	return func(config *ReloaderConfig) {
+		config.Paths = paths
+	}
+}
+
+// ReloaderWithInclude sets the glob patterns of the files that trigger a
+// reload. The patterns are matched against the file name and the file path.
+func ReloaderWithInclude(patterns ...string) ReloaderOption {
+	return func(config *ReloaderConfig) {
+		config.Include = patterns
+	}
+}
+
+// ReloaderWithExclude sets the glob patterns of the files and the directories
+// that are ignored. The patterns are matched against the name and the path.
+func ReloaderWithExclude(patterns ...string) ReloaderOption {
+	return func(config *ReloaderConfig) {
+		config.Exclude = patterns
+	}
+}
+
+// ReloaderWithDelay sets the time to wait for more changes before the reload.
+// Every change postpones the reload. The files are reloaded on every change if
+// the delay is zero.
+func ReloaderWithDelay(delay time.Duration) ReloaderOption {
+	return func(config *ReloaderConfig) {
+		config.Delay = delay
+	}
+}
+
 // Reloader reloads the page
 type Reloader struct {
-	watcher *fsnotify.Watcher
-	server  *hub.Hub
+	config   *ReloaderConfig
+	watcher  *fsnotify.Watcher
+	upgrader websocket.Upgrader
+	mutex    sync.Mutex
+	clients  map[*websocket.Conn]bool
+	done     chan struct{}
+	wait     sync.WaitGroup
+	once     sync.Once
 }
 
-// LiveReloader reloads a webpage
+// reloaderScript connects the page to the reloader. It reloads the page, or
+// swaps the changed stylesheets in place, and reconnects when the server
+// restarts.
+const reloaderScript = `(function () {
+  var scheme = window.location.protocol === 'https:' ? 'wss://' : 'ws://';
+  var url = scheme + window.location.host + '/livereload';
+  var connected = false;
+  var delay = 500;
+
+  function swapStyles(files) {
+    var links = document.querySelectorAll('link[rel="stylesheet"][href]');
+    var swapped = 0;
+
+    Array.prototype.forEach.call(links, function (link) {
+      var href = new URL(link.getAttribute('href'), window.location.href);
+      var name = href.pathname.split('/').pop();
+
+      var changed = files.some(function (file) {
+        return file === href.pathname || file.endsWith(href.pathname) || file.split('/').pop() === name;
+      });
+
+      if (changed) {
+        href.searchParams.set('livereload', Date.now());
+
+        var clone = link.cloneNode();
+        clone.href = href.toString();
+        clone.addEventListener('load', function () { link.remove(); });
+        link.parentNode.insertBefore(clone, link.nextSibling);
+        swapped++;
+      }
+    });
+
+    return swapped > 0;
+  }
+
+  function connect() {
+    var socket = new WebSocket(url);
+
+    socket.addEventListener('open', function () {
+      // the server has been restarted
+      if (connected) {
+        window.location.reload();
+        return;
+      }
+
+      connected = true;
+      delay = 500;
+    });
+
+    socket.addEventListener('message', function (event) {
+      var message = JSON.parse(event.data);
+
+      if (message.topic !== 'notify') {
+        return;
+      }
+
+      if (message.data === 'css' && swapStyles(message.files || [])) {
+        return;
+      }
+
+      window.location.reload();
+    });
+
+    socket.addEventListener('close', function () {
+      setTimeout(connect, delay);
+      delay = Math.min(delay * 2, 5000);
+    });
+  }
+
+  connect();
+})();
+`
+
+// reloaderMessage is the message sent to the pages
+type reloaderMessage struct {
+	Topic string   `json:"topic"`
+	Data  string   `json:"data"`
+	Files []string `json:"files,omitempty"`
+}
+
+// LiveReloader reloads a webpage when a file in the working directory
+// changes. The requests are served as they are if the file system cannot be
+// watched.
 func LiveReloader(next http.Handler) http.Handler {
-	reloader := NewReloader()
+	reloader, err := NewReloader()
+	if err != nil {
+		log.WithError(err).Error("live reloader is disabled")
+		return next
+	}
+
 	return reloader.ServeHTTP(next)
 }
 
-// NewReloader creates a new reloader
-func NewReloader() *Reloader {
+// NewReloader creates a new reloader. It watches the working directory by
+// default. The hidden files and directories are excluded by default.
+func NewReloader(options ...ReloaderOption) (*Reloader, error) {
+	config := &ReloaderConfig{
+		Paths:   []string{"."},
+		Exclude: []string{".*", "*~"},
+		Delay:   100 * time.Millisecond,
+	}
+
+	for _, option := range options {
+		option(config)
+	}
+
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	watcher.Add(".")
-
 	reloader := &Reloader{
-		server:  hub.New(os.Stdout, "*"),
+		config:  config,
 		watcher: watcher,
+		clients: make(map[*websocket.Conn]bool),
+		done:    make(chan struct{}),
+		upgrader: websocket.Upgrader{
+			// the pages may be served by another dev server
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
 	}
 
+	for _, path := range config.Paths {
+		if err := reloader.watch(path); err != nil {
+			//nolint:errcheck
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	reloader.wait.Add(1)
 	go reloader.notify()
-	go reloader.server.Run()
 
-	return reloader
+	return reloader, nil
 }
 
 // ServeHTTP serves the reloader
@@ -55,50 +228,511 @@ func (l *Reloader) ServeHTTP(next http.Handler) http.Handler {
 		}
 
 		if path == "/livereload" {
-			l.server.ServeHTTP(w, r)
+			l.connect(w, r)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		// the responses to HEAD have the length of the body without the script
+		if r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := &reloaderWriter{ResponseWriter: w}
+		next.ServeHTTP(writer.wrap(), r)
+		writer.close()
 	}
 
 	return http.HandlerFunc(fn)
 }
 
+// Close stops watching the file system and closes the connections of the
+// pages
+func (l *Reloader) Close() error {
+	var err error
+
+	l.once.Do(func() {
+		close(l.done)
+		err = l.watcher.Close()
+		l.wait.Wait()
+
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		for conn := range l.clients {
+			//nolint:errcheck
+			conn.Close()
+			delete(l.clients, conn)
+		}
+	})
+
+	return err
+}
+
 func (l *Reloader) script(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/javascript")
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	//nolint:errcheck
+	io.WriteString(w, reloaderScript)
+}
+
+// connect upgrades the request to a websocket connection and keeps it until
+// the page goes away or the reloader is closed
+func (l *Reloader) connect(w http.ResponseWriter, r *http.Request) {
+	conn, err := l.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has responded already
+		GetLogger(r).WithError(err).Warn("live reload connection fail")
+		return
+	}
+
+	l.mutex.Lock()
+	select {
+	case <-l.done:
+		l.mutex.Unlock()
+		//nolint:errcheck
+		conn.Close()
+		return
+	default:
+		l.clients[conn] = true
+	}
+	l.mutex.Unlock()
+
+	// the pages do not send messages, the read fails when the connection is closed
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			break
+		}
+	}
+
+	l.mutex.Lock()
+	delete(l.clients, conn)
+	l.mutex.Unlock()
+
+	//nolint:errcheck
+	conn.Close()
+}
+
+// watch adds the directory and its subdirectories to the watcher
+func (l *Reloader) watch(root string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 
-	buffer := &bytes.Buffer{}
+		if !entry.IsDir() {
+			return nil
+		}
 
-	fmt.Fprintln(buffer, "const liveUrl = 'ws://' + window.location.hostname + ':' + window.location.port + '/livereload';")
-	fmt.Fprintln(buffer, "const socket = new WebSocket(liveUrl);")
-	fmt.Fprintln(buffer, "socket.addEventListener('message', function (event) {")
-	fmt.Fprintln(buffer, "  const message = JSON.parse(event.data);")
-	fmt.Fprintln(buffer, "  if (message.topic === 'notify' && message.data === 'reload') {")
-	fmt.Fprintln(buffer, "    liveReload();")
-	fmt.Fprintln(buffer, "  }")
-	fmt.Fprintln(buffer, "});")
+		if path != root && l.match(l.config.Exclude, path) {
+			return filepath.SkipDir
+		}
 
-	io.Copy(w, buffer)
+		return l.watcher.Add(path)
+	})
 }
 
 func (l *Reloader) notify() {
+	defer l.wait.Done()
+
+	var (
+		// the timer is started by the first event
+		timer   = time.NewTimer(time.Hour)
+		pending = make(map[string]bool)
+	)
+
+	reloaderStop(timer)
+
+	flush := func() {
+		files := make([]string, 0, len(pending))
+
+		for name := range pending {
+			files = append(files, filepath.ToSlash(name))
+		}
+
+		sort.Strings(files)
+
+		pending = make(map[string]bool)
+		l.reload(files)
+	}
+
 	for {
 		select {
-		case event := <-l.watcher.Events:
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				l.reload(event)
+		case <-l.done:
+			timer.Stop()
+			return
+		case event, ok := <-l.watcher.Events:
+			if !ok {
+				return
+			}
+
+			if !l.accept(event) {
+				continue
+			}
+
+			pending[event.Name] = true
+
+			if l.config.Delay <= 0 {
+				flush()
+				continue
+			}
+
+			// the reload waits until the burst of events is over
+			reloaderStop(timer)
+			timer.Reset(l.config.Delay)
+		case err, ok := <-l.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			log.WithError(err).Warn("live reload watch fail")
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// reloaderStop stops the timer and drains its channel, so a stale expiration
+// does not trigger a reload
+func reloaderStop(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+// accept reports whether the event triggers a reload. The created directories
+// are watched too.
+func (l *Reloader) accept(event fsnotify.Event) bool {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+		return false
+	}
+
+	if l.match(l.config.Exclude, event.Name) {
+		return false
+	}
+
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := l.watch(event.Name); err != nil {
+				log.WithError(err).WithField("path", event.Name).Warn("live reload watch fail")
 			}
+
+			return false
 		}
 	}
+
+	if len(l.config.Include) == 0 {
+		return true
+	}
+
+	return l.match(l.config.Include, event.Name)
 }
 
-func (l *Reloader) reload(event fsnotify.Event) {
-	msg := &hub.Message{
+// match reports whether the name or the path matches any of the patterns
+func (l *Reloader) match(patterns []string, path string) bool {
+	var (
+		name = filepath.Base(path)
+		slug = filepath.ToSlash(filepath.Clean(path))
+	)
+
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+
+		if ok, _ := filepath.Match(filepath.ToSlash(pattern), slug); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *Reloader) reload(files []string) {
+	msg := &reloaderMessage{
 		Topic: "notify",
-		Data:  "reload",
+		Data:  "css",
+		Files: files,
+	}
+
+	// the stylesheets are swapped in place, anything else reloads the page
+	for _, name := range files {
+		if !strings.EqualFold(filepath.Ext(name), ".css") {
+			msg.Data = "reload"
+			break
+		}
+	}
+
+	log.WithField("files", files).Info("reloading")
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for conn := range l.clients {
+		//nolint:errcheck
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+
+		if err := conn.WriteJSON(msg); err != nil {
+			//nolint:errcheck
+			conn.Close()
+			delete(l.clients, conn)
+		}
 	}
+}
+
+// reloaderWriter injects the reloader script into the HTML responses. Only
+// the HTML responses are buffered. The http.Hijacker, http.Pusher and
+// io.ReaderFrom interfaces are forwarded to the underlying writer.
+type reloaderWriter struct {
+	http.ResponseWriter
+	status  int
+	decided bool
+	inject  bool
+	buffer  bytes.Buffer
+}
+
+// WriteHeader decides whether the response is buffered for the injection
+func (w *reloaderWriter) WriteHeader(status int) {
+	if w.decided {
+		return
+	}
+
+	w.decided = true
+
+	var (
+		header    = w.Header()
+		mediatype = strings.ToLower(header.Get("Content-Type"))
+	)
+
+	// the compressed responses cannot be modified
+	w.inject = strings.HasPrefix(mediatype, "text/html") &&
+		header.Get("Content-Encoding") == "" &&
+		status != http.StatusNoContent &&
+		status != http.StatusNotModified
+
+	if w.inject {
+		w.status = status
+		header.Del("Content-Length")
+		return
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes the data
+func (w *reloaderWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.inject {
+		return w.buffer.Write(data)
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+// reloaderFlusher flushes the responses that are not injected
+type reloaderFlusher struct {
+	writer *reloaderWriter
+}
+
+// Flush flushes the responses that are not injected
+func (f reloaderFlusher) Flush() {
+	if f.writer.inject {
+		return
+	}
+
+	f.writer.decided = true
+	f.writer.ResponseWriter.(http.Flusher).Flush()
+}
+
+// reloaderHijacker lets the handler take over the connection
+type reloaderHijacker struct {
+	writer *reloaderWriter
+}
+
+// Hijack lets the handler take over the connection
+func (h reloaderHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	// the response is not written by the writer anymore
+	h.writer.decided = true
+	h.writer.inject = false
+
+	return h.writer.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// reloaderPusher initiates the HTTP/2 server pushes
+type reloaderPusher struct {
+	writer *reloaderWriter
+}
+
+// Push initiates an HTTP/2 server push
+func (p reloaderPusher) Push(target string, options *http.PushOptions) error {
+	return p.writer.ResponseWriter.(http.Pusher).Push(target, options)
+}
+
+// reloaderReaderFrom copies the responses that are not injected by the
+// underlying writer
+type reloaderReaderFrom struct {
+	writer *reloaderWriter
+}
+
+// ReadFrom reads the data from the reader until EOF
+func (f reloaderReaderFrom) ReadFrom(r io.Reader) (int64, error) {
+	if f.writer.decided && !f.writer.inject {
+		return f.writer.ResponseWriter.(io.ReaderFrom).ReadFrom(r)
+	}
+
+	// the writer is hidden, so the copy does not call ReadFrom again
+	return io.Copy(struct{ io.Writer }{f.writer}, r)
+}
+
+// wrap returns a response writer that implements only the optional
+// interfaces implemented by the underlying writer
+func (w *reloaderWriter) wrap() http.ResponseWriter {
+	var (
+		f = reloaderFlusher{w}
+		h = reloaderHijacker{w}
+		p = reloaderPusher{w}
+		r = reloaderReaderFrom{w}
+	)
+
+	_, flusher := w.ResponseWriter.(http.Flusher)
+	_, hijacker := w.ResponseWriter.(http.Hijacker)
+	_, pusher := w.ResponseWriter.(http.Pusher)
+	_, reader := w.ResponseWriter.(io.ReaderFrom)
+
+	switch {
+	case flusher && hijacker && pusher && reader:
+		return struct {
+			*reloaderWriter
+			reloaderFlusher
+			reloaderHijacker
+			reloaderPusher
+			reloaderReaderFrom
+		}{w, f, h, p, r}
+	case flusher && hijacker && pusher:
+		return struct {
+			*reloaderWriter
+			reloaderFlusher
+			reloaderHijacker
+			reloaderPusher
+		}{w, f, h, p}
+	case flusher && hijacker && reader:
+		return struct {
+			*reloaderWriter
+			reloaderFlusher
+			reloaderHijacker
+			reloaderReaderFrom
+		}{w, f, h, r}
+	case flusher && pusher && reader:
+		return struct {
+			*reloaderWriter
+			reloaderFlusher
+			reloaderPusher
+			reloaderReaderFrom
+		}{w, f, p, r}
+	case hijacker && pusher && reader:
+		return struct {
+			*reloaderWriter
+			reloaderHijacker
+			reloaderPusher
+			reloaderReaderFrom
+		}{w, h, p, r}
+	case flusher && hijacker:
+		return struct {
+			*reloaderWriter
+			reloaderFlusher
+			reloaderHijacker
+		}{w, f, h}
+	case flusher && pusher:
+		return struct {
+			*reloaderWriter
+			reloaderFlusher
+			reloaderPusher
+		}{w, f, p}
+	case flusher && reader:
+		return struct {
+			*reloaderWriter
+			reloaderFlusher
+			reloaderReaderFrom
+		}{w, f, r}
+	case hijacker && pusher:
+		return struct {
+			*reloaderWriter
+			reloaderHijacker
+			reloaderPusher
+		}{w, h, p}
+	case hijacker && reader:
+		return struct {
+			*reloaderWriter
+			reloaderHijacker
+			reloaderReaderFrom
+		}{w, h, r}
+	case pusher && reader:
+		return struct {
+			*reloaderWriter
+			reloaderPusher
+			reloaderReaderFrom
+		}{w, p, r}
+	case flusher:
+		return struct {
+			*reloaderWriter
+			reloaderFlusher
+		}{w, f}
+	case hijacker:
+		return struct {
+			*reloaderWriter
+			reloaderHijacker
+		}{w, h}
+	case pusher:
+		return struct {
+			*reloaderWriter
+			reloaderPusher
+		}{w, p}
+	case reader:
+		return struct {
+			*reloaderWriter
+			reloaderReaderFrom
+		}{w, r}
+	default:
+		return w
+	}
+}
+
+// close writes the buffered response with the script before the closing body
+// tag or at the end of the document
+func (w *reloaderWriter) close() {
+	if !w.inject {
+		return
+	}
+
+	var (
+		body  = w.buffer.Bytes()
+		tag   = []byte(`<script src="/livereload.js"></script>`)
+		index = bytes.LastIndex(bytes.ToLower(body), []byte("</body>"))
+	)
+
+	if index < 0 {
+		index = len(body)
+	}
+
+	data := make([]byte, 0, len(body)+len(tag))
+	data = append(data, body[:index]...)
+	data = append(data, tag...)
+	data = append(data, body[index:]...)
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.ResponseWriter.WriteHeader(w.status)
 
-	log.WithField("event", event.Name).Info("reloading")
-	l.server.Broadcast <- msg
+	//nolint:errcheck
+	w.ResponseWriter.Write(data)
 }
@@ -0,0 +1,289 @@
+package middleware_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/phogolabs/rest/middleware"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reloader", func() {
+	var (
+		dir      string
+		reloader *middleware.Reloader
+		server   *httptest.Server
+		conn     *websocket.Conn
+		delay    time.Duration
+	)
+
+	type Message struct {
+		Topic string   `json:"topic"`
+		Data  string   `json:"data"`
+		Files []string `json:"files"`
+	}
+
+	Receive := func() *Message {
+		msg := &Message{}
+		Expect(conn.SetReadDeadline(time.Now().Add(2 * time.Second))).To(Succeed())
+		Expect(conn.ReadJSON(msg)).To(Succeed())
+		return msg
+	}
+
+	WriteFile := func(name string) {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte("body"), 0o600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		delay = 50 * time.Millisecond
+		dir = GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(dir, "assets", "css"), 0o755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, ".git"), 0o755)).To(Succeed())
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		reloader, err = middleware.NewReloader(
+			middleware.ReloaderWithPaths(dir),
+			middleware.ReloaderWithInclude("*.html", "*.css"),
+			middleware.ReloaderWithExclude(".*", "tmp"),
+			middleware.ReloaderWithDelay(delay),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		server = httptest.NewServer(reloader.ServeHTTP(http.NotFoundHandler()))
+
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/livereload"
+		conn, _, err = websocket.DefaultDialer.Dial(url, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		//nolint:errcheck
+		conn.Close()
+		server.Close()
+		Expect(reloader.Close()).To(Succeed())
+	})
+
+	It("coalesces the changes of the nested directories", func() {
+		WriteFile("index.html")
+		WriteFile("assets/css/main.css")
+
+		msg := Receive()
+		Expect(msg.Topic).To(Equal("notify"))
+		Expect(msg.Data).To(Equal("reload"))
+		Expect(msg.Files).To(ConsistOf(
+			filepath.ToSlash(filepath.Join(dir, "index.html")),
+			filepath.ToSlash(filepath.Join(dir, "assets", "css", "main.css")),
+		))
+	})
+
+	It("postpones the reload until the changes stop", func() {
+		for _, name := range []string{"index.html", "about.html", "contact.html"} {
+			WriteFile(name)
+			time.Sleep(35 * time.Millisecond)
+		}
+
+		Expect(Receive().Files).To(HaveLen(3))
+	})
+
+	Context("when the delay is zero", func() {
+		BeforeEach(func() {
+			delay = 0
+		})
+
+		It("reloads on every change", func() {
+			WriteFile("index.html")
+			Expect(Receive().Files).To(ConsistOf(HaveSuffix("/index.html")))
+		})
+	})
+
+	It("swaps the stylesheets in place", func() {
+		WriteFile("assets/css/main.css")
+
+		msg := Receive()
+		Expect(msg.Data).To(Equal("css"))
+		Expect(msg.Files).To(ConsistOf(HaveSuffix("/assets/css/main.css")))
+	})
+
+	It("watches the created directories", func() {
+		Expect(os.MkdirAll(filepath.Join(dir, "pages"), 0o755)).To(Succeed())
+		// let the watcher add the directory
+		time.Sleep(100 * time.Millisecond)
+
+		WriteFile("pages/about.html")
+		Expect(Receive().Files).To(ContainElement(HaveSuffix("pages/about.html")))
+	})
+
+	It("reloads when a file is removed", func() {
+		WriteFile("index.html")
+		Receive()
+
+		Expect(os.Remove(filepath.Join(dir, "index.html"))).To(Succeed())
+		Expect(Receive().Files).To(ConsistOf(HaveSuffix("index.html")))
+	})
+
+	It("ignores the excluded and not included files", func() {
+		WriteFile(".git/index.html")
+		WriteFile("main.go")
+		WriteFile("index.html")
+
+		Expect(Receive().Files).To(ConsistOf(HaveSuffix("/index.html")))
+	})
+
+	Context("when the path does not exist", func() {
+		It("returns an error", func() {
+			_, err := middleware.NewReloader(middleware.ReloaderWithPaths(filepath.Join(dir, "missing")))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when the reloader is closed", func() {
+		It("closes the connections", func() {
+			Expect(reloader.Close()).To(Succeed())
+
+			Expect(conn.SetReadDeadline(time.Now().Add(2 * time.Second))).To(Succeed())
+			_, _, err := conn.ReadMessage()
+			Expect(err).To(HaveOccurred())
+			Expect(err).NotTo(MatchError(ContainSubstring("timeout")))
+		})
+	})
+
+	It("serves the script", func() {
+		response, err := http.Get(server.URL + "/livereload.js")
+		Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+
+		data, err := io.ReadAll(response.Body)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(response.Header.Get("Content-Type")).To(HavePrefix("text/javascript"))
+		Expect(string(data)).To(ContainSubstring("wss://"))
+		Expect(string(data)).NotTo(ContainSubstring("liveReload()"))
+	})
+
+	Describe("ServeHTTP", func() {
+		Serve := func(contentType, body string) *httptest.ResponseRecorder {
+			handler := reloader.ServeHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", contentType)
+
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, body)
+			}))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/", nil))
+			return recorder
+		}
+
+		It("injects the script into the HTML responses", func() {
+			recorder := Serve("text/html; charset=utf-8", "<html><BODY><h1>Hello</h1></BODY></html>")
+
+			Expect(recorder.Code).To(Equal(http.StatusCreated))
+			Expect(recorder.Body.String()).To(Equal(`<html><BODY><h1>Hello</h1><script src="/livereload.js"></script></BODY></html>`))
+			Expect(recorder.Header().Get("Content-Length")).To(Equal(strconv.Itoa(recorder.Body.Len())))
+		})
+
+		It("appends the script to the HTML fragments", func() {
+			handler := reloader.ServeHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "<h1>Hello</h1>")
+			}))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/", nil))
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(Equal(`<h1>Hello</h1><script src="/livereload.js"></script>`))
+		})
+
+		It("does not inject the script into other responses", func() {
+			recorder := Serve("application/json", `{"body":"</body>"}`)
+			Expect(recorder.Body.String()).To(Equal(`{"body":"</body>"}`))
+		})
+
+		It("does not inject the script into the responses to HEAD", func() {
+			handler := reloader.ServeHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.Header().Set("Content-Length", "14")
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("HEAD", "http://example.com/", nil))
+
+			Expect(recorder.Header().Get("Content-Length")).To(Equal("14"))
+			Expect(recorder.Body.String()).To(BeEmpty())
+		})
+
+		It("copies the responses with ReadFrom", func() {
+			upstream := httptest.NewServer(reloader.ServeHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+
+				_, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader("<h1>Hello</h1>"))
+				Expect(err).NotTo(HaveOccurred())
+			})))
+			defer upstream.Close()
+
+			response, err := http.Get(upstream.URL)
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close()
+
+			data, err := io.ReadAll(response.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal(`<h1>Hello</h1><script src="/livereload.js"></script>`))
+		})
+
+		It("exposes only the interfaces implemented by the writer", func() {
+			handler := reloader.ServeHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, ok := w.(http.Flusher)
+				Expect(ok).To(BeTrue())
+
+				_, ok = w.(http.Hijacker)
+				Expect(ok).To(BeFalse())
+
+				_, ok = w.(http.Pusher)
+				Expect(ok).To(BeFalse())
+
+				_, ok = w.(io.ReaderFrom)
+				Expect(ok).To(BeFalse())
+			}))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/", nil))
+		})
+
+		It("lets the handler hijack the connection", func() {
+			upstream := httptest.NewServer(reloader.ServeHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, buffer, err := w.(http.Hijacker).Hijack()
+				Expect(err).NotTo(HaveOccurred())
+				//nolint:errcheck
+				defer conn.Close()
+
+				fmt.Fprint(buffer, "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+				Expect(buffer.Flush()).To(Succeed())
+			})))
+			defer upstream.Close()
+
+			response, err := http.Get(upstream.URL)
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close()
+
+			data, err := io.ReadAll(response.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("ok"))
+		})
+	})
+})
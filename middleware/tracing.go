@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/phogolabs/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/semconv/v1.17.0/httpconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingName is the name of the tracer of the Tracing middleware
+const TracingName = "github.com/phogolabs/rest/middleware"
+
+// TracingConfig represents the configuration of the Tracing middleware
+type TracingConfig struct {
+	// TracerProvider provides the tracer of the spans
+	TracerProvider trace.TracerProvider
+	// Propagator extracts the span context from the request headers
+	Propagator propagation.TextMapPropagator
+}
+
+// TracingOption represents a tracing option
+type TracingOption func(config *TracingConfig)
+
+// TracingWithTracerProvider sets the tracer provider
+func TracingWithTracerProvider(provider trace.TracerProvider) TracingOption {
+	return func(config *TracingConfig) {
+		config.TracerProvider = provider
+	}
+}
+
+// TracingWithPropagator sets the propagator
+func TracingWithPropagator(propagator propagation.TextMapPropagator) TracingOption {
+	return func(config *TracingConfig) {
+		config.Propagator = propagator
+	}
+}
+
+// TracingWithOption returns a middleware that starts a server span for each
+// request. The parent span is extracted from the traceparent and tracestate
+// headers. The span is named after the route pattern and records the status
+// code of the response. The trace and span IDs are added to the request
+// logger. It uses the global tracer provider and the W3C trace context
+// propagator by default.
+func TracingWithOption(options ...TracingOption) func(http.Handler) http.Handler {
+	config := &TracingConfig{
+		TracerProvider: otel.GetTracerProvider(),
+		Propagator: propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+	}
+
+	for _, option := range options {
+		option(config)
+	}
+
+	tracer := config.TracerProvider.Tracer(TracingName)
+
+	mw := func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := config.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			ctx, span := tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(httpconv.ServerRequest("", r)...),
+			)
+			defer span.End()
+
+			// the logger is enriched when the Logger middleware precedes
+			logger := log.GetContext(ctx).WithFields(TracingFields(span.SpanContext()))
+			ctx = log.SetContext(ctx, logger)
+
+			r = r.WithContext(ctx)
+
+			writer := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(writer, r)
+
+			status := writer.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			// the route pattern is resolved once the request is routed
+			if rctx := chi.RouteContext(ctx); rctx != nil {
+				if pattern := rctx.RoutePattern(); pattern != "" {
+					span.SetName(r.Method + " " + pattern)
+					span.SetAttributes(semconv.HTTPRouteKey.String(pattern))
+				}
+			}
+
+			span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+			span.SetStatus(httpconv.ServerStatus(status))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+
+	return mw
+}
+
+// Tracing is a middleware that starts a server span for each request
+func Tracing(next http.Handler) http.Handler {
+	fn := TracingWithOption()
+	return fn(next)
+}
+
+// TracingFields returns the logger fields of the span context
+func TracingFields(sc trace.SpanContext) log.Map {
+	if !sc.IsValid() {
+		return log.Map{}
+	}
+
+	return log.Map{
+		"trace_id": sc.TraceID().String(),
+		"span_id":  sc.SpanID().String(),
+	}
+}
@@ -0,0 +1,112 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/phogolabs/log"
+	"github.com/phogolabs/log/handler/json"
+	"github.com/phogolabs/rest/middleware"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		router   chi.Router
+		exporter *tracetest.InMemoryExporter
+		status   int
+	)
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		exporter = tracetest.NewInMemoryExporter()
+
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+		router = chi.NewRouter()
+		router.Use(middleware.TracingWithOption(middleware.TracingWithTracerProvider(provider)))
+		router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		})
+	})
+
+	It("starts a span named after the route pattern", func() {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/users/1", nil))
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(1))
+
+		span := spans[0]
+		Expect(span.Name).To(Equal("GET /users/{id}"))
+		Expect(span.SpanKind).To(Equal(trace.SpanKindServer))
+		Expect(span.Attributes).To(ContainElement(semconv.HTTPRouteKey.String("/users/{id}")))
+		Expect(span.Attributes).To(ContainElement(semconv.HTTPStatusCodeKey.Int(http.StatusOK)))
+		Expect(span.Status.Code).To(Equal(codes.Unset))
+	})
+
+	It("continues the trace of the traceparent header", func() {
+		request := httptest.NewRequest("GET", "http://example.com/users/1", nil)
+		request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(1))
+
+		span := spans[0]
+		Expect(span.SpanContext.TraceID().String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(span.Parent.SpanID().String()).To(Equal("00f067aa0ba902b7"))
+		Expect(span.Parent.IsRemote()).To(BeTrue())
+	})
+
+	Context("when the handler fails", func() {
+		BeforeEach(func() {
+			status = http.StatusInternalServerError
+		})
+
+		It("sets the error status", func() {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/users/1", nil))
+
+			spans := exporter.GetSpans()
+			Expect(spans).To(HaveLen(1))
+
+			span := spans[0]
+			Expect(span.Attributes).To(ContainElement(semconv.HTTPStatusCodeKey.Int(http.StatusInternalServerError)))
+			Expect(span.Status.Code).To(Equal(codes.Error))
+		})
+	})
+
+	Context("when the logger is used", func() {
+		It("adds the trace and span IDs to the logger", func() {
+			output := gbytes.NewBuffer()
+			log.SetHandler(json.New(output))
+
+			router.With(middleware.Logger).Get("/accounts", func(w http.ResponseWriter, r *http.Request) {
+				middleware.GetLogger(r).Info("hello")
+			})
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("GET", "http://example.com/accounts", nil))
+
+			spans := exporter.GetSpans()
+			Expect(spans).To(HaveLen(1))
+
+			sc := spans[0].SpanContext
+			Expect(output).To(gbytes.Say("hello"))
+			Expect(output).To(gbytes.Say(sc.SpanID().String()))
+			Expect(output).To(gbytes.Say(sc.TraceID().String()))
+		})
+	})
+})
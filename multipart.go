@@ -0,0 +1,307 @@
+package rest
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/form/v4"
+	"github.com/go-playground/validator/v10"
+	"github.com/phogolabs/rest/middleware"
+)
+
+// DefaultMaxMemory is the number of bytes of the multipart form parts that are
+// kept in memory. The rest is stored in temporary files.
+const DefaultMaxMemory = 32 << 20
+
+var multipartCtxKey = &middleware.ContextKey{Name: "MultipartCleanup"}
+
+// File represents an uploaded file of a multipart form. The file is opened on
+// the first read.
+type File struct {
+	*multipart.FileHeader
+	reader multipart.File
+}
+
+// Read reads the content of the file
+func (f *File) Read(p []byte) (n int, err error) {
+	if f.reader == nil {
+		if f.reader, err = f.FileHeader.Open(); err != nil {
+			return 0, err
+		}
+	}
+
+	return f.reader.Read(p)
+}
+
+// Close closes the file
+func (f *File) Close() error {
+	if f.reader == nil {
+		return nil
+	}
+
+	err := f.reader.Close()
+	f.reader = nil
+	return err
+}
+
+// multipartCleanup tracks the multipart forms and the files of a request, so
+// the temporary files can be removed after the handler returns
+type multipartCleanup struct {
+	mutex sync.Mutex
+	forms []*multipart.Form
+	files []*File
+}
+
+func (c *multipartCleanup) track(form *multipart.Form, files ...*File) {
+	// the route does not track the forms
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if form != nil {
+		c.forms = append(c.forms, form)
+	}
+
+	c.files = append(c.files, files...)
+}
+
+func (c *multipartCleanup) release() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, file := range c.files {
+		//nolint:errcheck
+		file.Close()
+	}
+
+	for _, form := range c.forms {
+		//nolint:errcheck
+		form.RemoveAll()
+	}
+
+	c.files = nil
+	c.forms = nil
+}
+
+// DecodeMultipartForm decodes an entity from a multipart form. The values are
+// decoded as form fields. The files are assigned to the fields of type
+// *multipart.FileHeader, []*multipart.FileHeader, *File and []*File that
+// match their form tag. The parts that exceed the memory threshold of
+// DecodeWithMaxMemory are stored in temporary files, which are removed after
+// the handler returns if the route uses DecodeWithOption. Otherwise the
+// handler must remove them by calling r.MultipartForm.RemoveAll once it is
+// done with the files, as the server removes only the form of the original
+// request.
+func DecodeMultipartForm(r *http.Request, v interface{}) error {
+	cleanup := multipartTracker(r)
+
+	if r.MultipartForm == nil {
+		memory := GetDecodeConfig(r).MaxMemory
+
+		if memory <= 0 {
+			memory = DefaultMaxMemory
+		}
+
+		if err := r.ParseMultipartForm(memory); err != nil {
+			return err
+		}
+
+		cleanup.track(r.MultipartForm)
+	}
+
+	if err := form.NewDecoder().Decode(v, r.MultipartForm.Value); err != nil {
+		return err
+	}
+
+	return decodeFiles(r, v, cleanup)
+}
+
+// multipartTracker returns the tracker of the route configured by
+// DecodeWithOption. It returns nil if the route does not track the forms.
+func multipartTracker(r *http.Request) *multipartCleanup {
+	cleanup, _ := r.Context().Value(multipartCtxKey).(*multipartCleanup)
+	return cleanup
+}
+
+// decodeFiles assigns the files of the multipart form to the fields of the
+// entity
+func decodeFiles(r *http.Request, v interface{}, cleanup *multipartCleanup) error {
+	value := reflect.ValueOf(v)
+
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var (
+		kind  = value.Type()
+		files = []*File{}
+	)
+
+	for index := 0; index < kind.NumField(); index++ {
+		field := kind.Field(index)
+
+		if field.PkgPath != "" || field.Tag.Get("form") == "-" {
+			continue
+		}
+
+		name := tagName(field, "form")
+		if name == "" {
+			name = field.Name
+		}
+
+		headers := r.MultipartForm.File[name]
+		if len(headers) == 0 {
+			continue
+		}
+
+		target := value.Field(index)
+
+		switch target.Interface().(type) {
+		case *multipart.FileHeader:
+			target.Set(reflect.ValueOf(headers[0]))
+		case []*multipart.FileHeader:
+			target.Set(reflect.ValueOf(headers))
+		case *File:
+			file := &File{FileHeader: headers[0]}
+			files = append(files, file)
+			target.Set(reflect.ValueOf(file))
+		case []*File:
+			items := make([]*File, 0, len(headers))
+
+			for _, header := range headers {
+				items = append(items, &File{FileHeader: header})
+			}
+
+			files = append(files, items...)
+			target.Set(reflect.ValueOf(items))
+		}
+	}
+
+	cleanup.track(nil, files...)
+	return nil
+}
+
+// fileHeaders is the value validated for the file fields. The file headers
+// are not validated as structs, so the file tags can be applied on them.
+type fileHeaders []*multipart.FileHeader
+
+// validationFile returns the file headers of the file fields
+func validationFile(field reflect.Value) interface{} {
+	switch value := field.Interface().(type) {
+	case multipart.FileHeader:
+		return fileHeaders{&value}
+	case File:
+		if value.FileHeader == nil {
+			return fileHeaders{}
+		}
+
+		return fileHeaders{value.FileHeader}
+	default:
+		return nil
+	}
+}
+
+// validationFileHeaders returns the file headers of the validated field
+func validationFileHeaders(field reflect.Value) []*multipart.FileHeader {
+	switch value := field.Interface().(type) {
+	case fileHeaders:
+		return value
+	case []*multipart.FileHeader:
+		return value
+	case []*File:
+		headers := make([]*multipart.FileHeader, 0, len(value))
+
+		for _, file := range value {
+			if file != nil && file.FileHeader != nil {
+				headers = append(headers, file.FileHeader)
+			}
+		}
+
+		return headers
+	default:
+		return nil
+	}
+}
+
+// validateFileSize reports whether the files do not exceed the size in bytes
+// given by the parameter, e.g. validate:"filesize=1048576"
+func validateFileSize(field validator.FieldLevel) bool {
+	limit, err := strconv.ParseInt(field.Param(), 10, 64)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, header := range validationFileHeaders(field.Field()) {
+		if header != nil && header.Size > limit {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateFileType reports whether the content type of the files matches one
+// of the space separated media ranges given by the parameter, e.g.
+// validate:"filetype=image/png image/jpeg". The content type is detected from
+// the content of the file rather than taken from the client.
+func validateFileType(field validator.FieldLevel) bool {
+	ranges := ParseAccept(strings.Join(strings.Fields(field.Param()), ","))
+
+	for _, header := range validationFileHeaders(field.Field()) {
+		if header == nil {
+			continue
+		}
+
+		kind, err := fileContentType(header)
+		if err != nil {
+			return false
+		}
+
+		matched := false
+
+		for index := range ranges {
+			if _, ok := ranges[index].Match(kind); ok {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fileContentType detects the content type of the file
+func fileContentType(header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	//nolint:errcheck
+	defer file.Close()
+
+	// http.DetectContentType considers at most 512 bytes
+	data := make([]byte, 512)
+
+	n, err := io.ReadFull(file, data)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	return codecKey(http.DetectContentType(data[:n])), nil
+}
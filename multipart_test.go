@@ -0,0 +1,182 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/phogolabs/rest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DecodeMultipartForm", func() {
+	type Upload struct {
+		Name        string                  `form:"name" validate:"required"`
+		Avatar      *multipart.FileHeader   `form:"avatar" validate:"required,filesize=1024,filetype=image/png image/gif"`
+		Document    *rest.File              `form:"document" validate:"omitempty,filetype=text/*"`
+		Attachments []*multipart.FileHeader `form:"attachments" validate:"omitempty,filesize=16"`
+	}
+
+	var (
+		parts   map[string][][]byte
+		request *http.Request
+	)
+
+	png := append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), make([]byte, 32)...)
+
+	BeforeEach(func() {
+		parts = map[string][][]byte{
+			"avatar":      {png},
+			"document":    {[]byte("hello world")},
+			"attachments": {[]byte("one"), []byte("two")},
+		}
+	})
+
+	JustBeforeEach(func() {
+		buffer := &bytes.Buffer{}
+		writer := multipart.NewWriter(buffer)
+
+		Expect(writer.WriteField("name", "John")).To(Succeed())
+
+		for name, items := range parts {
+			for _, data := range items {
+				part, err := writer.CreateFormFile(name, name+".bin")
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = part.Write(data)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+
+		Expect(writer.Close()).To(Succeed())
+
+		request = httptest.NewRequest("POST", "http://example.com", buffer)
+		request.Header.Set("Content-Type", writer.FormDataContentType())
+	})
+
+	It("decodes the values and the files", func() {
+		entity := Upload{}
+
+		Expect(rest.Decode(request, &entity)).To(Succeed())
+		Expect(entity.Name).To(Equal("John"))
+		Expect(entity.Avatar.Filename).To(Equal("avatar.bin"))
+		Expect(entity.Avatar.Size).To(BeEquivalentTo(len(png)))
+		Expect(entity.Attachments).To(HaveLen(2))
+
+		data, err := io.ReadAll(entity.Document)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("hello world"))
+		Expect(entity.Document.Close()).To(Succeed())
+	})
+
+	Context("when the file is too large", func() {
+		BeforeEach(func() {
+			parts["attachments"] = [][]byte{[]byte("one"), bytes.Repeat([]byte("a"), 17)}
+		})
+
+		It("returns the field error", func() {
+			entity := Upload{}
+
+			err := rest.Decode(request, &entity)
+			Expect(err).To(HaveOccurred())
+
+			errs := rest.FieldErrors(err)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("attachments"))
+			Expect(errs[0].Tag).To(Equal("filesize"))
+		})
+	})
+
+	Context("when the file type is not allowed", func() {
+		BeforeEach(func() {
+			parts["avatar"] = [][]byte{[]byte("plain text")}
+		})
+
+		It("returns the field error", func() {
+			entity := Upload{}
+
+			err := rest.Decode(request, &entity)
+			Expect(err).To(HaveOccurred())
+
+			errs := rest.FieldErrors(err)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("avatar"))
+			Expect(errs[0].Tag).To(Equal("filetype"))
+		})
+	})
+
+	Context("when the file is missing", func() {
+		BeforeEach(func() {
+			delete(parts, "avatar")
+		})
+
+		It("returns the field error", func() {
+			entity := Upload{}
+
+			err := rest.Decode(request, &entity)
+			Expect(err).To(HaveOccurred())
+
+			errs := rest.FieldErrors(err)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("avatar"))
+			Expect(errs[0].Tag).To(Equal("required"))
+		})
+	})
+
+	Context("when the parts exceed the memory threshold", func() {
+		It("removes the temporary files after the handler returns", func() {
+			entity := Upload{}
+
+			handler := rest.DecodeWithOption(rest.DecodeWithMaxMemory(1))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(rest.Decode(r, &entity)).To(Succeed())
+
+				file, err := entity.Avatar.Open()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(file.Close()).To(Succeed())
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			_, err := entity.Avatar.Open()
+			Expect(err).To(HaveOccurred())
+		})
+
+		Context("when the route does not configure the decoding", func() {
+			BeforeEach(func() {
+				// the parts exceed the default memory threshold
+				parts["avatar"] = [][]byte{append(png, make([]byte, rest.DefaultMaxMemory)...)}
+			})
+
+			It("keeps the temporary files until the handler removes them", func() {
+				entity := Upload{}
+
+				ctx, cancel := context.WithCancel(request.Context())
+				request = request.WithContext(ctx)
+
+				Expect(rest.DecodeMultipartForm(request, &entity)).To(Succeed())
+
+				// the client disconnects while the handler is running
+				cancel()
+
+				Consistently(func() error {
+					file, err := entity.Avatar.Open()
+					if err == nil {
+						file.Close()
+					}
+					return err
+				}, 100*time.Millisecond).Should(Succeed())
+
+				Expect(request.MultipartForm.RemoveAll()).To(Succeed())
+
+				_, err := entity.Avatar.Open()
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,190 @@
+package rest
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MediaRange represents a media range of the Accept header
+type MediaRange struct {
+	Type    string
+	Subtype string
+	Params  map[string]string
+	Quality float64
+}
+
+// String returns the media range without parameters
+func (m *MediaRange) String() string {
+	return m.Type + "/" + m.Subtype
+}
+
+// Match reports whether the media range matches the media type. The
+// specificity of the match is returned as well. The structured syntax suffix
+// of the media range matches its base type, e.g. application/vnd.acme+json
+// matches application/json.
+func (m *MediaRange) Match(mediaType string) (int, bool) {
+	kind, subtype := mediaSplit(mediaType)
+
+	switch {
+	case m.Type == "*" && m.Subtype == "*":
+		return 1, true
+	case m.Type != kind:
+		return 0, false
+	case m.Subtype == "*":
+		return 2, true
+	case m.Subtype == subtype:
+		return 4, true
+	case strings.HasSuffix(m.Subtype, "+"+mediaSuffix(subtype)):
+		return 3, true
+	default:
+		return 0, false
+	}
+}
+
+// ParseAccept parses the media ranges of the Accept header. The ranges are
+// ordered by their quality value.
+func ParseAccept(header string) []MediaRange {
+	ranges := []MediaRange{}
+
+	for _, field := range strings.Split(header, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+
+		mediaType, params, err := mime.ParseMediaType(field)
+		if err != nil {
+			continue
+		}
+
+		kind, subtype := mediaSplit(mediaType)
+		// some clients send a single asterisk
+		if kind == "*" && subtype == "" {
+			subtype = "*"
+		}
+
+		item := MediaRange{
+			Type:    kind,
+			Subtype: subtype,
+			Params:  params,
+			Quality: 1,
+		}
+
+		if value, ok := params["q"]; ok {
+			if quality, err := strconv.ParseFloat(value, 64); err == nil {
+				item.Quality = quality
+			}
+
+			delete(params, "q")
+		}
+
+		ranges = append(ranges, item)
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].Quality > ranges[j].Quality
+	})
+
+	return ranges
+}
+
+// Negotiate returns the offered media type that is most preferred by the
+// Accept header of the request. The first offer is returned if the request
+// does not have an Accept header.
+func Negotiate(r *http.Request, offers ...string) (string, bool) {
+	offer, _, ok := negotiate(r.Header.Get("Accept"), offers)
+	return offer, ok
+}
+
+// negotiate returns the most preferred offer and the media type that should
+// be sent to the client. They differ when a vendor media type is accepted.
+func negotiate(header string, offers []string) (string, string, bool) {
+	if len(offers) == 0 {
+		return "", "", false
+	}
+
+	if strings.TrimSpace(header) == "" {
+		return offers[0], offers[0], true
+	}
+
+	var (
+		ranges  = ParseAccept(header)
+		best    = -1
+		rank    = 0
+		quality = 0.0
+		kind    = ""
+	)
+
+	for index, offer := range offers {
+		var (
+			matched     = -1
+			specificity = 0
+		)
+
+		// the most specific range determines the quality of the offer
+		for position := range ranges {
+			if value, ok := ranges[position].Match(offer); ok && value > specificity {
+				matched = position
+				specificity = value
+			}
+		}
+
+		if matched == -1 || ranges[matched].Quality <= 0 {
+			continue
+		}
+
+		item := &ranges[matched]
+
+		// the ties are resolved by the order of the Accept header
+		if best == -1 || item.Quality > quality || (item.Quality == quality && matched < rank) {
+			best = index
+			rank = matched
+			quality = item.Quality
+			kind = offer
+
+			// the vendor media type is sent to the client
+			if specificity == 3 {
+				kind = item.String()
+			}
+		}
+	}
+
+	if best == -1 {
+		return "", "", false
+	}
+
+	return offers[best], kind, true
+}
+
+// negotiateVary adds Accept to the Vary header
+func negotiateVary(w http.ResponseWriter) {
+	for _, value := range w.Header().Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), "Accept") {
+				return
+			}
+		}
+	}
+
+	w.Header().Add("Vary", "Accept")
+}
+
+func mediaSplit(mediaType string) (string, string) {
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	if index := strings.Index(mediaType, "/"); index != -1 {
+		return mediaType[:index], mediaType[index+1:]
+	}
+
+	return mediaType, ""
+}
+
+func mediaSuffix(subtype string) string {
+	if index := strings.LastIndex(subtype, "+"); index != -1 {
+		return subtype[index+1:]
+	}
+
+	return subtype
+}
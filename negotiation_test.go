@@ -0,0 +1,123 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/phogolabs/rest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseAccept", func() {
+	It("orders the media ranges by quality", func() {
+		ranges := rest.ParseAccept("text/html;q=0.5, application/json, */*;q=0.1, application/xml;level=1")
+		Expect(ranges).To(HaveLen(4))
+
+		Expect(ranges[0].String()).To(Equal("application/json"))
+		Expect(ranges[1].String()).To(Equal("application/xml"))
+		Expect(ranges[1].Params).To(HaveKeyWithValue("level", "1"))
+		Expect(ranges[2].String()).To(Equal("text/html"))
+		Expect(ranges[2].Quality).To(Equal(0.5))
+		Expect(ranges[3].String()).To(Equal("*/*"))
+	})
+})
+
+var _ = Describe("Negotiate", func() {
+	var request *http.Request
+
+	BeforeEach(func() {
+		request = httptest.NewRequest("GET", "http://example.com", nil)
+	})
+
+	It("returns the first offer when the Accept header is missing", func() {
+		offer, ok := rest.Negotiate(request, "application/json", "application/xml")
+		Expect(ok).To(BeTrue())
+		Expect(offer).To(Equal("application/json"))
+	})
+
+	It("honors the quality values", func() {
+		request.Header.Set("Accept", "application/json;q=0.5, application/xml")
+
+		offer, ok := rest.Negotiate(request, "application/json", "application/xml")
+		Expect(ok).To(BeTrue())
+		Expect(offer).To(Equal("application/xml"))
+	})
+
+	It("honors the wildcards", func() {
+		request.Header.Set("Accept", "text/*, application/*;q=0.2")
+
+		offer, ok := rest.Negotiate(request, "application/json", "text/csv")
+		Expect(ok).To(BeTrue())
+		Expect(offer).To(Equal("text/csv"))
+	})
+
+	It("excludes the media types with zero quality", func() {
+		request.Header.Set("Accept", "*/*, application/json;q=0")
+
+		offer, ok := rest.Negotiate(request, "application/json", "application/xml")
+		Expect(ok).To(BeTrue())
+		Expect(offer).To(Equal("application/xml"))
+	})
+
+	It("matches the vendor media types by their suffix", func() {
+		request.Header.Set("Accept", "application/vnd.acme+json")
+
+		offer, ok := rest.Negotiate(request, "application/xml", "application/json")
+		Expect(ok).To(BeTrue())
+		Expect(offer).To(Equal("application/json"))
+	})
+
+	Context("when none of the offers is acceptable", func() {
+		It("returns false", func() {
+			request.Header.Set("Accept", "text/csv")
+
+			_, ok := rest.Negotiate(request, "application/json", "application/xml")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("Respond", func() {
+		var recorder *httptest.ResponseRecorder
+
+		BeforeEach(func() {
+			recorder = httptest.NewRecorder()
+		})
+
+		It("sets the Vary header", func() {
+			rest.Respond(recorder, request, "hello")
+			Expect(recorder.Header().Values("Vary")).To(ConsistOf("Accept"))
+		})
+
+		It("responds with the vendor media type", func() {
+			request.Header.Set("Accept", "application/vnd.acme+json")
+
+			rest.Respond(recorder, request, "hello")
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/vnd.acme+json; charset=utf-8"))
+			Expect(recorder.Body.String()).To(ContainSubstring("hello"))
+		})
+
+		It("responds with the preferred media type", func() {
+			request.Header.Set("Accept", "text/html, application/xml;q=0.9, */*;q=0.8")
+
+			rest.Respond(recorder, request, "hello")
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/xml; charset=utf-8"))
+		})
+
+		Context("when none of the media types is acceptable", func() {
+			It("responds with 406", func() {
+				request.Header.Set("Accept", "text/csv")
+
+				rest.Respond(recorder, request, "hello")
+				Expect(recorder.Code).To(Equal(http.StatusNotAcceptable))
+				Expect(recorder.Header().Get("Content-Type")).To(Equal("application/problem+json; charset=utf-8"))
+
+				problem := &rest.Problem{}
+				Expect(json.NewDecoder(recorder.Body).Decode(problem)).To(Succeed())
+				Expect(problem.Status).To(Equal(http.StatusNotAcceptable))
+			})
+		})
+	})
+})
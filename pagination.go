@@ -0,0 +1,370 @@
+package rest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/errors/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/phogolabs/rest/middleware"
+)
+
+var (
+	// ErrInvalidCursor returns invalid cursor error
+	ErrInvalidCursor = fmt.Errorf("invalid cursor")
+
+	// ErrNoCursorSecret returns no cursor secret error
+	ErrNoCursorSecret = fmt.Errorf("no cursor secret")
+)
+
+var paginationCtxKey = &middleware.ContextKey{Name: "Pagination"}
+
+// DefaultPagination is the pagination used by DecodePage. Its cursors are
+// signed with a random key generated at start, so they cannot be used across
+// processes. Set the Secret if the service has more than one instance.
+var DefaultPagination = &Pagination{
+	DefaultLimit: 20,
+	MaxLimit:     100,
+	Secret:       paginationSecret(),
+}
+
+// paginationValidator validates the pages. The pagelimit and pagecursor tags
+// are not registered on the DefaultValidator.
+var paginationValidator = func() *Validator {
+	checker := NewValidator()
+	checker.options = append(checker.options,
+		func(validate *validator.Validate) error {
+			return validate.RegisterValidationCtx("pagelimit", validatePageLimit)
+		},
+		func(validate *validator.Validate) error {
+			return validate.RegisterValidationCtx("pagecursor", validatePageCursor)
+		},
+	)
+
+	return checker
+}()
+
+// Pagination decodes the pages requested by the clients of the list endpoints
+type Pagination struct {
+	// DefaultLimit is the limit of the pages that are requested without one
+	DefaultLimit int
+	// MaxLimit is the largest limit that can be requested. The limit is not
+	// bounded if it is zero.
+	MaxLimit int
+	// Secret is the key of the signature of the cursors. The cursors cannot be
+	// encoded or verified without it.
+	Secret []byte
+}
+
+// Page represents a page requested with the limit, offset and cursor query
+// parameters. The offset and the cursor are mutually exclusive.
+type Page struct {
+	Limit  int    `query:"limit" json:"limit" xml:"limit" validate:"omitempty,pagelimit"`
+	Offset int    `query:"offset" json:"offset,omitempty" xml:"offset,omitempty" validate:"gte=0"`
+	Cursor string `query:"cursor" json:"cursor,omitempty" xml:"cursor,omitempty" validate:"omitempty,pagecursor,excluded_with=Offset"`
+}
+
+// PageResult represents a page of items
+type PageResult struct {
+	// Items is the slice of the items of the page
+	Items interface{}
+	// Total is the number of all items. It is optional.
+	Total *int64
+	// NextCursor is the cursor of the next page
+	NextCursor string
+	// PrevCursor is the cursor of the previous page
+	PrevCursor string
+}
+
+// PageEnvelope is the body of the page responses
+type PageEnvelope struct {
+	XMLName xml.Name    `json:"-" xml:"page"`
+	Data    interface{} `json:"data" xml:"data"`
+	Meta    PageMeta    `json:"meta" xml:"meta"`
+}
+
+// PageMeta represents the pagination details of a page response
+type PageMeta struct {
+	Limit      int    `json:"limit" xml:"limit"`
+	Offset     int    `json:"offset,omitempty" xml:"offset,omitempty"`
+	Total      *int64 `json:"total,omitempty" xml:"total,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty" xml:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty" xml:"prev_cursor,omitempty"`
+}
+
+type pageHeader struct {
+	Link       []string `header:"Link,omitempty"`
+	TotalCount *int64   `header:"X-Total-Count,omitempty"`
+}
+
+// Decode decodes the page from the query of the request. The limit is set to
+// the default limit if it is not provided. It responds with 400 Bad Request if
+// the query cannot be decoded and with 422 Unprocessable Entity if the limit
+// is out of bounds or the cursor is invalid.
+func (p *Pagination) Decode(r *http.Request) (*Page, error) {
+	page := &Page{}
+
+	if err := DecodeQuery(r, page); err != nil {
+		return nil, errors.Wrap(err, "decode").
+			AddTag("status", http.StatusBadRequest).
+			AddTag(ProblemExtensionPrefix+"source", "query")
+	}
+
+	ctx := context.WithValue(r.Context(), paginationCtxKey, p)
+
+	if err := paginationValidator.ValidateRequest(r.WithContext(ctx), page); err != nil {
+		return nil, errors.Wrap(err, "decode").AddTag("sources", decodeSources(page, err))
+	}
+
+	if page.Limit == 0 {
+		page.Limit = p.DefaultLimit
+	}
+
+	return page, nil
+}
+
+// EncodeCursor encodes the value as an opaque cursor signed with the secret.
+// It returns ErrNoCursorSecret if the secret is not set.
+func (p *Pagination) EncodeCursor(v interface{}) (string, error) {
+	if len(p.Secret) == 0 {
+		return "", ErrNoCursorSecret
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		payload   = base64.RawURLEncoding.EncodeToString(data)
+		signature = base64.RawURLEncoding.EncodeToString(p.sign(data))
+	)
+
+	return payload + "." + signature, nil
+}
+
+// DecodeCursor verifies the signature of the cursor and decodes its value
+func (p *Pagination) DecodeCursor(cursor string, v interface{}) error {
+	data, err := p.verify(cursor)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrInvalidCursor
+	}
+
+	return nil
+}
+
+func (p *Pagination) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, p.Secret)
+	//nolint:errcheck
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (p *Pagination) verify(cursor string) ([]byte, error) {
+	// the cursors signed without a key can be forged
+	if len(p.Secret) == 0 {
+		return nil, ErrNoCursorSecret
+	}
+
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if !hmac.Equal(signature, p.sign(data)) {
+		return nil, ErrInvalidCursor
+	}
+
+	return data, nil
+}
+
+// paginationSecret generates a random key of the cursor signatures
+func paginationSecret() []byte {
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+
+	return secret
+}
+
+// DecodePage decodes the page from the query of the request with the default
+// pagination
+func DecodePage(r *http.Request) (*Page, error) {
+	return DefaultPagination.Decode(r)
+}
+
+// RespondPage responds with the items of the page wrapped in a PageEnvelope.
+// The first, prev, next and last pages are linked in the Link header. The last
+// page is linked and the X-Total-Count header is set only if the total is
+// known. The cursors of the result take precedence over the offset.
+func RespondPage(w http.ResponseWriter, r *http.Request, page *Page, result *PageResult) {
+	if err := projectionCheck(r, result.Items); err != nil {
+		Respond(w, r, err)
+		return
+	}
+
+	header := &pageHeader{
+		Link:       pageLinks(r, page, result),
+		TotalCount: result.Total,
+	}
+
+	if err := EncodeHeader(w, header); err != nil {
+		Respond(w, r, err)
+		return
+	}
+
+	Respond(w, r, &PageEnvelope{
+		Data: result.Items,
+		Meta: PageMeta{
+			Limit:      page.Limit,
+			Offset:     page.Offset,
+			Total:      result.Total,
+			NextCursor: result.NextCursor,
+			PrevCursor: result.PrevCursor,
+		},
+	})
+}
+
+func pageLinks(r *http.Request, page *Page, result *PageResult) []string {
+	var (
+		links = []string{}
+		link  = func(rel string, params map[string]string) {
+			query := r.URL.Query()
+
+			for key, value := range params {
+				if value == "" {
+					query.Del(key)
+					continue
+				}
+
+				query.Set(key, value)
+			}
+
+			target := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+			links = append(links, fmt.Sprintf("<%s>; rel=%q", target.String(), rel))
+		}
+	)
+
+	// cursor based pages
+	if page.Cursor != "" || result.NextCursor != "" || result.PrevCursor != "" {
+		link("first", map[string]string{"cursor": "", "offset": ""})
+
+		if result.PrevCursor != "" {
+			link("prev", map[string]string{"cursor": result.PrevCursor})
+		}
+
+		if result.NextCursor != "" {
+			link("next", map[string]string{"cursor": result.NextCursor})
+		}
+
+		return links
+	}
+
+	if page.Limit <= 0 {
+		return links
+	}
+
+	offset := func(value int) map[string]string {
+		param := strconv.Itoa(value)
+		if value == 0 {
+			param = ""
+		}
+
+		return map[string]string{"offset": param}
+	}
+
+	link("first", offset(0))
+
+	if page.Offset > 0 {
+		prev := page.Offset - page.Limit
+		if prev < 0 {
+			prev = 0
+		}
+
+		link("prev", offset(prev))
+	}
+
+	next := page.Offset + page.Limit
+
+	switch {
+	case result.Total != nil:
+		if int64(next) < *result.Total {
+			link("next", offset(next))
+		}
+
+		if *result.Total > 0 {
+			last := ((*result.Total - 1) / int64(page.Limit)) * int64(page.Limit)
+			link("last", offset(int(last)))
+		}
+	case pageCount(result.Items) >= page.Limit:
+		// the next page may exist if the page is full
+		link("next", offset(next))
+	}
+
+	return links
+}
+
+func pageCount(items interface{}) int {
+	value := reflect.ValueOf(items)
+
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		return value.Len()
+	default:
+		return 0
+	}
+}
+
+// validatePageLimit reports whether the limit does not exceed the maximum
+// limit of the pagination
+func validatePageLimit(ctx context.Context, field validator.FieldLevel) bool {
+	limit := field.Field().Int()
+
+	if limit < 1 {
+		return false
+	}
+
+	if pagination, ok := ctx.Value(paginationCtxKey).(*Pagination); ok && pagination.MaxLimit > 0 {
+		return limit <= int64(pagination.MaxLimit)
+	}
+
+	return true
+}
+
+// validatePageCursor reports whether the cursor is signed by the pagination
+func validatePageCursor(ctx context.Context, field validator.FieldLevel) bool {
+	pagination, ok := ctx.Value(paginationCtxKey).(*Pagination)
+	if !ok {
+		return false
+	}
+
+	_, err := pagination.verify(field.Field().String())
+	return err == nil
+}
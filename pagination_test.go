@@ -0,0 +1,219 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/phogolabs/rest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pagination", func() {
+	var pagination *rest.Pagination
+
+	BeforeEach(func() {
+		pagination = &rest.Pagination{
+			DefaultLimit: 10,
+			MaxLimit:     50,
+			Secret:       []byte("secret"),
+		}
+	})
+
+	Describe("Decode", func() {
+		It("decodes the limit and the offset", func() {
+			request := httptest.NewRequest("GET", "http://example.com/users?limit=5&offset=15", nil)
+
+			page, err := pagination.Decode(request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Limit).To(Equal(5))
+			Expect(page.Offset).To(Equal(15))
+		})
+
+		It("sets the default limit", func() {
+			request := httptest.NewRequest("GET", "http://example.com/users", nil)
+
+			page, err := pagination.Decode(request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Limit).To(Equal(10))
+		})
+
+		It("decodes the cursor", func() {
+			cursor, err := pagination.EncodeCursor(map[string]int{"id": 42})
+			Expect(err).NotTo(HaveOccurred())
+
+			request := httptest.NewRequest("GET", "http://example.com/users?cursor="+cursor, nil)
+
+			page, err := pagination.Decode(request)
+			Expect(err).NotTo(HaveOccurred())
+
+			key := map[string]int{}
+			Expect(pagination.DecodeCursor(page.Cursor, &key)).To(Succeed())
+			Expect(key).To(HaveKeyWithValue("id", 42))
+		})
+
+		Context("when the limit exceeds the maximum", func() {
+			It("returns an error", func() {
+				request := httptest.NewRequest("GET", "http://example.com/users?limit=51", nil)
+
+				_, err := pagination.Decode(request)
+				Expect(err).To(HaveOccurred())
+
+				errs := rest.FieldErrors(err)
+				Expect(errs).To(HaveLen(1))
+				Expect(errs[0].Field).To(Equal("limit"))
+				Expect(errs[0].Tag).To(Equal("pagelimit"))
+				Expect(errs[0].Source).To(Equal("query"))
+			})
+		})
+
+		Context("when the limit is not a number", func() {
+			It("returns an error", func() {
+				request := httptest.NewRequest("GET", "http://example.com/users?limit=ten", nil)
+
+				_, err := pagination.Decode(request)
+				Expect(err).To(HaveOccurred())
+
+				recorder := httptest.NewRecorder()
+				rest.Respond(recorder, request, err)
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("when the cursor is tampered", func() {
+			It("returns an error", func() {
+				other := &rest.Pagination{Secret: []byte("other")}
+
+				cursor, err := other.EncodeCursor(42)
+				Expect(err).NotTo(HaveOccurred())
+
+				request := httptest.NewRequest("GET", "http://example.com/users?cursor="+cursor, nil)
+
+				_, err = pagination.Decode(request)
+				Expect(err).To(HaveOccurred())
+
+				errs := rest.FieldErrors(err)
+				Expect(errs).To(HaveLen(1))
+				Expect(errs[0].Field).To(Equal("cursor"))
+				Expect(errs[0].Tag).To(Equal("pagecursor"))
+
+				Expect(pagination.DecodeCursor(cursor, new(int))).To(MatchError(rest.ErrInvalidCursor))
+			})
+		})
+
+		Context("when the secret is not set", func() {
+			BeforeEach(func() {
+				pagination.Secret = nil
+			})
+
+			It("does not accept the unsigned cursors", func() {
+				_, err := pagination.EncodeCursor(42)
+				Expect(err).To(MatchError(rest.ErrNoCursorSecret))
+
+				request := httptest.NewRequest("GET", "http://example.com/users?cursor=NDI.", nil)
+
+				_, err = pagination.Decode(request)
+				Expect(err).To(HaveOccurred())
+
+				errs := rest.FieldErrors(err)
+				Expect(errs).To(HaveLen(1))
+				Expect(errs[0].Tag).To(Equal("pagecursor"))
+			})
+		})
+	})
+})
+
+var _ = Describe("DecodePage", func() {
+	It("signs the cursors with a random key", func() {
+		cursor, err := rest.DefaultPagination.EncodeCursor(42)
+		Expect(err).NotTo(HaveOccurred())
+
+		request := httptest.NewRequest("GET", "http://example.com/users?cursor="+cursor, nil)
+
+		page, err := rest.DecodePage(request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Cursor).To(Equal(cursor))
+	})
+
+	It("does not register the page tags on the default validator", func() {
+		entity := &struct {
+			Limit int `validate:"pagelimit"`
+		}{}
+
+		request := httptest.NewRequest("GET", "http://example.com/users", nil)
+
+		Expect(func() { _ = rest.Validate(request, entity) }).To(Panic())
+	})
+})
+
+var _ = Describe("RespondPage", func() {
+	var recorder *httptest.ResponseRecorder
+
+	BeforeEach(func() {
+		recorder = httptest.NewRecorder()
+	})
+
+	It("responds with the offset links", func() {
+		var (
+			total   = int64(45)
+			request = httptest.NewRequest("GET", "http://example.com/users?limit=10&offset=20&sort=name", nil)
+			page    = &rest.Page{Limit: 10, Offset: 20}
+		)
+
+		rest.RespondPage(recorder, request, page, &rest.PageResult{
+			Items: []string{"john"},
+			Total: &total,
+		})
+
+		Expect(recorder.Header().Get("X-Total-Count")).To(Equal("45"))
+		Expect(recorder.Header().Values("Link")).To(ConsistOf(
+			`</users?limit=10&sort=name>; rel="first"`,
+			`</users?limit=10&offset=10&sort=name>; rel="prev"`,
+			`</users?limit=10&offset=30&sort=name>; rel="next"`,
+			`</users?limit=10&offset=40&sort=name>; rel="last"`,
+		))
+
+		envelope := map[string]interface{}{}
+		Expect(json.NewDecoder(recorder.Body).Decode(&envelope)).To(Succeed())
+		Expect(envelope).To(HaveKeyWithValue("data", ConsistOf("john")))
+		Expect(envelope).To(HaveKeyWithValue("meta", HaveKeyWithValue("total", BeEquivalentTo(45))))
+	})
+
+	It("responds with the cursor links", func() {
+		var (
+			request = httptest.NewRequest("GET", "http://example.com/users?limit=10", nil)
+			page    = &rest.Page{Limit: 10}
+		)
+
+		rest.RespondPage(recorder, request, page, &rest.PageResult{
+			Items:      []string{"john"},
+			NextCursor: "abc",
+		})
+
+		Expect(recorder.Header().Get("X-Total-Count")).To(BeEmpty())
+		Expect(recorder.Header().Values("Link")).To(ConsistOf(
+			`</users?limit=10>; rel="first"`,
+			`</users?cursor=abc&limit=10>; rel="next"`,
+		))
+	})
+
+	Context("when the total is unknown", func() {
+		It("links the next page if the page is full", func() {
+			var (
+				request = httptest.NewRequest("GET", "http://example.com/users?limit=2", nil)
+				page    = &rest.Page{Limit: 2}
+			)
+
+			rest.RespondPage(recorder, request, page, &rest.PageResult{
+				Items: []string{"john", "jack"},
+			})
+
+			Expect(recorder.Header().Values("Link")).To(ConsistOf(
+				`</users?limit=2>; rel="first"`,
+				`</users?limit=2&offset=2>; rel="next"`,
+			))
+		})
+	})
+})
@@ -0,0 +1,359 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/phogolabs/rest/middleware"
+)
+
+const (
+	// ContentTypeProblemJSON is the media type of RFC 9457 JSON documents
+	ContentTypeProblemJSON = "application/problem+json"
+	// ContentTypeProblemXML is the media type of RFC 9457 XML documents
+	ContentTypeProblemXML = "application/problem+xml"
+	// ProblemNamespace is the XML namespace of the problem details documents
+	ProblemNamespace = "urn:ietf:rfc:7807"
+	// ProblemExtensionPrefix is the prefix of the error tags that are rendered
+	// as problem details extension members
+	ProblemExtensionPrefix = middleware.ProblemExtensionPrefix
+)
+
+// Problem represents a problem details document as defined in RFC 7807 and
+// RFC 9457. The members can be set on an error by adding the "type", "title",
+// "status", "detail" and "instance" tags. Every tag prefixed with
+// ProblemExtensionPrefix is rendered as an extension member.
+type Problem struct {
+	Type       string                 `json:"type,omitempty" xml:"type,omitempty"`
+	Title      string                 `json:"title,omitempty" xml:"title,omitempty"`
+	Status     int                    `json:"status,omitempty" xml:"status,omitempty"`
+	Detail     string                 `json:"detail,omitempty" xml:"detail,omitempty"`
+	Instance   string                 `json:"instance,omitempty" xml:"instance,omitempty"`
+	Extensions map[string]interface{} `json:"-" xml:"-"`
+}
+
+// Error returns the problem as string
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+
+	return p.Title + ": " + p.Detail
+}
+
+// MarshalJSON marshals the problem as JSON object
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+
+	set := func(key string, value interface{}, empty bool) {
+		if !empty {
+			members[key] = value
+		}
+	}
+
+	set("type", p.Type, p.Type == "")
+	set("title", p.Title, p.Title == "")
+	set("status", p.Status, p.Status == 0)
+	set("detail", p.Detail, p.Detail == "")
+	set("instance", p.Instance, p.Instance == "")
+
+	return json.Marshal(members)
+}
+
+// UnmarshalJSON unmarshals the problem from JSON object
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	type problem Problem
+
+	entity := problem{}
+
+	if err := json.Unmarshal(data, &entity); err != nil {
+		return err
+	}
+
+	members := make(map[string]interface{})
+
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	for _, key := range []string{"type", "title", "status", "detail", "instance"} {
+		delete(members, key)
+	}
+
+	if len(members) > 0 {
+		entity.Extensions = members
+	}
+
+	*p = Problem(entity)
+	return nil
+}
+
+// MarshalXML marshals the problem as XML element
+func (p *Problem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{
+		Name: xml.Name{Space: ProblemNamespace, Local: "problem"},
+	}
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	members := []struct {
+		key   string
+		value interface{}
+		empty bool
+	}{
+		{key: "type", value: p.Type, empty: p.Type == ""},
+		{key: "title", value: p.Title, empty: p.Title == ""},
+		{key: "status", value: p.Status, empty: p.Status == 0},
+		{key: "detail", value: p.Detail, empty: p.Detail == ""},
+		{key: "instance", value: p.Instance, empty: p.Instance == ""},
+	}
+
+	for _, member := range members {
+		if member.empty {
+			continue
+		}
+
+		if err := e.EncodeElement(member.value, xmlStart(member.key)); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(p.Extensions))
+
+	for key := range p.Extensions {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := xmlEncode(e, key, p.Extensions[key]); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// UnmarshalXML unmarshals the problem from XML element
+func (p *Problem) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	value, err := xmlDecode(d)
+	if err != nil {
+		return err
+	}
+
+	members, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	entity := Problem{}
+
+	for key, value := range members {
+		text, _ := value.(string)
+
+		switch key {
+		case "type":
+			entity.Type = text
+		case "title":
+			entity.Title = text
+		case "status":
+			if err := json.Unmarshal([]byte(text), &entity.Status); err != nil {
+				return err
+			}
+		case "detail":
+			entity.Detail = text
+		case "instance":
+			entity.Instance = text
+		default:
+			if entity.Extensions == nil {
+				entity.Extensions = make(map[string]interface{})
+			}
+
+			entity.Extensions[key] = value
+		}
+	}
+
+	*p = entity
+	return nil
+}
+
+// ProblemJSON marshals the problem as application/problem+json document
+func ProblemJSON(w http.ResponseWriter, r *http.Request, p *Problem) {
+	buffer := &bytes.Buffer{}
+
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(true)
+
+	if err := encoder.Encode(p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	problemWrite(w, p, ContentTypeProblemJSON, buffer.Bytes())
+}
+
+// ProblemXML marshals the problem as application/problem+xml document
+func ProblemXML(w http.ResponseWriter, r *http.Request, p *Problem) {
+	data, err := xml.Marshal(p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	buffer := bytes.NewBufferString(xml.Header)
+	buffer.Write(data)
+
+	problemWrite(w, p, ContentTypeProblemXML, buffer.Bytes())
+}
+
+func problemRespond(w http.ResponseWriter, r *http.Request, p *Problem) {
+	negotiateVary(w)
+
+	// the content type is forced by the SetContentType middleware
+	if kind, ok := r.Context().Value(render.ContentTypeCtxKey).(render.ContentType); ok {
+		if kind == render.ContentTypeXML {
+			ProblemXML(w, r, p)
+		} else {
+			ProblemJSON(w, r, p)
+		}
+
+		return
+	}
+
+	// the problem is sent as JSON when none of the offers is acceptable
+	offer, _ := Negotiate(r, "application/json", "application/xml", "text/xml")
+
+	switch offer {
+	case "application/xml", "text/xml":
+		ProblemXML(w, r, p)
+	default:
+		ProblemJSON(w, r, p)
+	}
+}
+
+func problemWrite(w http.ResponseWriter, p *Problem, kind string, data []byte) {
+	w.Header().Set("Content-Type", kind+"; charset=utf-8")
+
+	if p.Status != 0 {
+		w.WriteHeader(p.Status)
+	}
+
+	//nolint:errcheck
+	w.Write(data)
+}
+
+func xmlStart(key string) xml.StartElement {
+	return xml.StartElement{Name: xml.Name{Local: key}}
+}
+
+func xmlEncode(e *xml.Encoder, key string, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	var (
+		start = xmlStart(key)
+		kind  = reflect.ValueOf(value)
+	)
+
+	switch kind.Kind() {
+	case reflect.Slice, reflect.Array:
+		// []byte is encoded as text by encoding/xml
+		if kind.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+
+		// arrays are represented as repeated "i" elements (RFC 7807 Appendix A)
+		for index := 0; index < kind.Len(); index++ {
+			if err := xmlEncode(e, "i", kind.Index(index).Interface()); err != nil {
+				return err
+			}
+		}
+
+		return e.EncodeToken(start.End())
+	case reflect.Map:
+		if kind.Type().Key().Kind() != reflect.String {
+			break
+		}
+
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+
+		keys := kind.MapKeys()
+
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, item := range keys {
+			if err := xmlEncode(e, item.String(), kind.MapIndex(item).Interface()); err != nil {
+				return err
+			}
+		}
+
+		return e.EncodeToken(start.End())
+	}
+
+	return e.EncodeElement(value, start)
+}
+
+func xmlDecode(d *xml.Decoder) (interface{}, error) {
+	var (
+		text     = &strings.Builder{}
+		members  = make(map[string]interface{})
+		items    = []interface{}{}
+		children = 0
+	)
+
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			value, err := xmlDecode(d)
+			if err != nil {
+				return nil, err
+			}
+
+			children++
+
+			if element.Name.Local == "i" {
+				items = append(items, value)
+			} else {
+				members[element.Name.Local] = value
+			}
+		case xml.CharData:
+			text.Write(element)
+		case xml.EndElement:
+			switch {
+			case children == 0:
+				return strings.TrimSpace(text.String()), nil
+			case len(members) == 0:
+				return items, nil
+			default:
+				return members, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+
+	"github.com/phogolabs/rest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Problem", func() {
+	var problem *rest.Problem
+
+	BeforeEach(func() {
+		problem = &rest.Problem{
+			Type:     "https://example.com/probs/out-of-credit",
+			Title:    "You do not have enough credit.",
+			Status:   http.StatusForbidden,
+			Detail:   "Your current balance is 30, but that costs 50.",
+			Instance: "/account/12345/msgs/abc",
+			Extensions: map[string]interface{}{
+				"accounts": []string{"/account/12345", "/account/67890"},
+			},
+		}
+	})
+
+	It("returns the error message", func() {
+		Expect(problem.Error()).To(Equal("You do not have enough credit.: Your current balance is 30, but that costs 50."))
+	})
+
+	It("marshals the extensions as JSON members", func() {
+		data, err := json.Marshal(problem)
+		Expect(err).NotTo(HaveOccurred())
+
+		members := map[string]interface{}{}
+		Expect(json.Unmarshal(data, &members)).To(Succeed())
+		Expect(members).To(HaveKeyWithValue("type", problem.Type))
+		Expect(members).To(HaveKeyWithValue("status", BeNumerically("==", http.StatusForbidden)))
+		Expect(members).To(HaveKeyWithValue("accounts", ConsistOf("/account/12345", "/account/67890")))
+
+		entity := &rest.Problem{}
+		Expect(json.Unmarshal(data, entity)).To(Succeed())
+		Expect(entity.Title).To(Equal(problem.Title))
+		Expect(entity.Extensions).To(HaveKeyWithValue("accounts", ConsistOf("/account/12345", "/account/67890")))
+	})
+
+	It("marshals the extensions as XML elements", func() {
+		data, err := xml.Marshal(problem)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(HavePrefix(`<problem xmlns="urn:ietf:rfc:7807">`))
+		Expect(string(data)).To(ContainSubstring("<accounts><i>/account/12345</i><i>/account/67890</i></accounts>"))
+
+		entity := &rest.Problem{}
+		Expect(xml.Unmarshal(data, entity)).To(Succeed())
+		Expect(entity.Status).To(Equal(http.StatusForbidden))
+		Expect(entity.Instance).To(Equal(problem.Instance))
+		Expect(entity.Extensions).To(HaveKeyWithValue("accounts", ConsistOf("/account/12345", "/account/67890")))
+	})
+})
@@ -0,0 +1,284 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/go-playground/errors/v5"
+)
+
+// ProjectionParam is the query parameter that selects the fields of the JSON
+// responses, e.g. ?fields=id,name,owner.email
+const ProjectionParam = "fields"
+
+// projection is a tree of the selected fields. The leaves select the whole
+// value of the field.
+type projection map[string]projection
+
+// projectionOf returns the projection requested by the client
+func projectionOf(r *http.Request) (projection, bool) {
+	if r.URL == nil {
+		return nil, false
+	}
+
+	values, ok := r.URL.Query()[ProjectionParam]
+	if !ok {
+		return nil, false
+	}
+
+	tree := projection{}
+
+	for _, value := range values {
+		for _, path := range strings.Split(value, ",") {
+			node := tree
+
+			for _, name := range strings.Split(strings.TrimSpace(path), ".") {
+				if name == "" {
+					continue
+				}
+
+				child, ok := node[name]
+				if !ok {
+					child = projection{}
+					node[name] = child
+				}
+
+				node = child
+			}
+		}
+	}
+
+	if len(tree) == 0 {
+		return nil, false
+	}
+
+	return tree, true
+}
+
+// project returns the JSON representation of the entity that contains only
+// the selected fields. It fails with 400 Bad Request if a selected field is
+// not a field of the entity.
+func project(v interface{}, tree projection) (interface{}, error) {
+	if err := tree.check(v); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return tree.apply(value), nil
+}
+
+// check fails with 400 Bad Request if a selected field is not a field of the
+// entity
+func (p projection) check(v interface{}) error {
+	if unknown := p.unknown(reflect.TypeOf(v), ""); len(unknown) > 0 {
+		sort.Strings(unknown)
+
+		err := errors.Newf("unknown fields %q", unknown).
+			AddTag("status", http.StatusBadRequest).
+			AddTag(ProblemExtensionPrefix+"unknown_fields", unknown)
+
+		return err
+	}
+
+	return nil
+}
+
+// apply removes the fields that are not selected
+func (p projection) apply(value interface{}) interface{} {
+	switch node := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(p))
+
+		for name, child := range p {
+			item, ok := node[name]
+			if !ok {
+				continue
+			}
+
+			if len(child) > 0 {
+				item = child.apply(item)
+			}
+
+			result[name] = item
+		}
+
+		return result
+	case []interface{}:
+		for index, item := range node {
+			node[index] = p.apply(item)
+		}
+
+		return node
+	default:
+		return value
+	}
+}
+
+// unknown returns the paths of the selected fields that are not fields of the
+// given type
+func (p projection) unknown(kind reflect.Type, prefix string) []string {
+	paths := []string{}
+
+	for kind != nil {
+		// the custom representations cannot be checked
+		if kind.Implements(projectionMarshaler) || reflect.PtrTo(kind).Implements(projectionMarshaler) {
+			return paths
+		}
+
+		switch kind.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			kind = kind.Elem()
+			continue
+		case reflect.Struct:
+			fields := projectionFields(kind)
+
+			for name, child := range p {
+				field, ok := fields[name]
+				if !ok {
+					paths = append(paths, prefix+name)
+					continue
+				}
+
+				if len(child) > 0 {
+					paths = append(paths, child.unknown(field.Type, prefix+name+".")...)
+				}
+			}
+
+			return paths
+		case reflect.Map, reflect.Interface:
+			return paths
+		default:
+			// the scalar values do not have fields
+			for name := range p {
+				paths = append(paths, prefix+name)
+			}
+
+			return paths
+		}
+	}
+
+	return paths
+}
+
+var projectionMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// projectionFields returns the fields of the struct by their JSON names
+func projectionFields(kind reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+
+	for index := 0; index < kind.NumField(); index++ {
+		field := kind.Field(index)
+		tag := field.Tag.Get("json")
+
+		if tag == "-" {
+			continue
+		}
+
+		name := tagName(field, "json")
+
+		// the fields of the embedded structs are promoted
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+
+			if embedded.Kind() == reflect.Struct {
+				for key, value := range projectionFields(embedded) {
+					if _, ok := fields[key]; !ok {
+						fields[key] = value
+					}
+				}
+
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		fields[name] = field
+	}
+
+	return fields
+}
+
+// projectionRespond applies the projection requested by the client on the
+// entity of a JSON response. The projection of the pages is applied on their
+// items.
+func projectionRespond(r *http.Request, contentType string, v interface{}) (interface{}, error) {
+	tree, ok := projectionRequest(r, contentType)
+	if !ok {
+		return v, nil
+	}
+
+	if envelope, ok := v.(*PageEnvelope); ok {
+		data, err := project(envelope.Data, tree)
+		if err != nil {
+			return nil, err
+		}
+
+		page := *envelope
+		page.Data = data
+
+		return &page, nil
+	}
+
+	return project(v, tree)
+}
+
+// projectionCheck fails if the projection requested by the client selects a
+// field that is not a field of the items of the page, so the error can be
+// reported before the headers of the page are set
+func projectionCheck(r *http.Request, items interface{}) error {
+	// the content type is forced by the SetContentType middleware
+	if _, ok := r.Context().Value(render.ContentTypeCtxKey).(render.ContentType); ok {
+		return nil
+	}
+
+	contentType, _, ok := codecResponse(r)
+	if !ok {
+		return nil
+	}
+
+	tree, ok := projectionRequest(r, contentType)
+	if !ok {
+		return nil
+	}
+
+	return tree.check(items)
+}
+
+// projectionRequest returns the projection requested by the client if the
+// response is JSON
+func projectionRequest(r *http.Request, contentType string) (projection, bool) {
+	if kind := codecKey(contentType); kind != "application/json" && !strings.HasSuffix(kind, "+json") {
+		return nil, false
+	}
+
+	return projectionOf(r)
+}
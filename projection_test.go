@@ -0,0 +1,131 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/phogolabs/rest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Projection", func() {
+	type Owner struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+
+	type Base struct {
+		ID int `json:"id"`
+	}
+
+	type Project struct {
+		Base
+		Name   string            `json:"name"`
+		Owner  *Owner            `json:"owner"`
+		Labels map[string]string `json:"labels"`
+		Secret string            `json:"-"`
+	}
+
+	var (
+		recorder *httptest.ResponseRecorder
+		projects []Project
+	)
+
+	BeforeEach(func() {
+		recorder = httptest.NewRecorder()
+
+		projects = []Project{
+			{
+				Base:   Base{ID: 1},
+				Name:   "rest",
+				Owner:  &Owner{Name: "John", Email: "john@example.com"},
+				Labels: map[string]string{"team": "core", "tier": "1"},
+			},
+		}
+	})
+
+	It("selects the fields of the response", func() {
+		request := httptest.NewRequest("GET", "http://example.com/projects?fields=id,name,owner.email,labels.team", nil)
+
+		rest.Respond(recorder, request, projects)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(MatchJSON(`[{"id":1,"name":"rest","owner":{"email":"john@example.com"},"labels":{"team":"core"}}]`))
+	})
+
+	It("selects the fields of the JSON response", func() {
+		request := httptest.NewRequest("GET", "http://example.com/projects?fields=owner", nil)
+
+		rest.JSON(recorder, request, projects[0])
+		Expect(recorder.Body.String()).To(MatchJSON(`{"owner":{"name":"John","email":"john@example.com"}}`))
+	})
+
+	Context("when the fields are not requested", func() {
+		It("responds with all fields", func() {
+			request := httptest.NewRequest("GET", "http://example.com/projects", nil)
+
+			rest.Respond(recorder, request, projects[0])
+			Expect(recorder.Body.String()).To(ContainSubstring(`"labels"`))
+		})
+	})
+
+	Context("when the response is not JSON", func() {
+		It("responds with all fields", func() {
+			request := httptest.NewRequest("GET", "http://example.com/projects?fields=name", nil)
+			request.Header.Set("Accept", "application/xml")
+
+			rest.Respond(recorder, request, &Owner{Name: "John", Email: "john@example.com"})
+			Expect(recorder.Body.String()).To(ContainSubstring("john@example.com"))
+		})
+	})
+
+	Context("when a field is unknown", func() {
+		It("responds with 400", func() {
+			request := httptest.NewRequest("GET", "http://example.com/projects?fields=name,secret,owner.phone", nil)
+
+			rest.Respond(recorder, request, projects)
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+
+			problem := &rest.Problem{}
+			Expect(json.NewDecoder(recorder.Body).Decode(problem)).To(Succeed())
+			Expect(problem.Extensions).To(HaveKeyWithValue("unknown_fields", ConsistOf("owner.phone", "secret")))
+		})
+	})
+
+	Context("when the response is a page", func() {
+		var (
+			page  *rest.Page
+			total = int64(1)
+		)
+
+		BeforeEach(func() {
+			page = &rest.Page{Limit: 10}
+		})
+
+		It("selects the fields of the items", func() {
+			request := httptest.NewRequest("GET", "http://example.com/projects?fields=id,owner.name", nil)
+
+			rest.RespondPage(recorder, request, page, &rest.PageResult{Items: projects, Total: &total})
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Values("Link")).NotTo(BeEmpty())
+			Expect(recorder.Body.String()).To(MatchJSON(`{"data":[{"id":1,"owner":{"name":"John"}}],"meta":{"limit":10,"total":1}}`))
+		})
+
+		Context("when a field is unknown", func() {
+			It("responds with 400 without the page headers", func() {
+				request := httptest.NewRequest("GET", "http://example.com/projects?fields=id,meta", nil)
+
+				rest.RespondPage(recorder, request, page, &rest.PageResult{Items: projects, Total: &total})
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Header().Values("Link")).To(BeEmpty())
+				Expect(recorder.Header().Get("X-Total-Count")).To(BeEmpty())
+
+				problem := &rest.Problem{}
+				Expect(json.NewDecoder(recorder.Body).Decode(problem)).To(Succeed())
+				Expect(problem.Extensions).To(HaveKeyWithValue("unknown_fields", ConsistOf("meta")))
+			})
+		})
+	})
+})
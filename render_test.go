@@ -5,7 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 
-	"github.com/go-playground/errors"
+	"github.com/go-playground/errors/v5"
 	"github.com/phogolabs/rest"
 
 	. "github.com/onsi/ginkgo/v2"
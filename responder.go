@@ -1,27 +1,84 @@
 package rest
 
 import (
+	"context"
+	"io"
 	"net/http"
+	"reflect"
+	"time"
 
 	"github.com/go-chi/render"
+	"github.com/go-playground/errors/v5"
 	"github.com/go-playground/form/v4"
+	"github.com/phogolabs/rest/middleware"
 )
 
 // Respond handles streaming JSON and XML responses, automatically setting the
 // Content-Type based on request headers. It will default to a JSON response.
+// The Accept header is negotiated with respect to the quality values and the
+// codecs registered by RegisterCodec. It responds with 406 Not Acceptable if
+// none of the media types is acceptable. The fields of the JSON responses are
+// selected by the fields query parameter, e.g. ?fields=id,name,owner.email.
+// The ETag of the response is computed if the route uses ETagWithOption and
+// the request is answered with 304 Not Modified if it matches If-None-Match.
+// Errors are rendered as application/problem+json or application/problem+xml
+// documents. Iterators and channels are streamed by Stream.
 func Respond(w http.ResponseWriter, r *http.Request, v interface{}) {
 	if err, ok := v.(error); ok {
-		v = errorf(r, err)
+		problemRespond(w, r, errorf(r, err))
+		return
 	}
 
-	render.DefaultResponder(w, r, v)
+	if _, ok := v.(Iterator); ok || v != nil && reflect.TypeOf(v).Kind() == reflect.Chan {
+		Stream(w, r, v)
+		return
+	}
+
+	negotiateRespond(w, r, v)
+}
+
+func negotiateRespond(w http.ResponseWriter, r *http.Request, v interface{}) {
+	negotiateVary(w)
+
+	// the content type is forced by the SetContentType middleware
+	if _, ok := r.Context().Value(render.ContentTypeCtxKey).(render.ContentType); ok {
+		render.DefaultResponder(w, r, v)
+		return
+	}
+
+	contentType, codec, ok := codecResponse(r)
+	if !ok {
+		err := errors.New("none of the acceptable media types is supported").
+			AddTag("status", http.StatusNotAcceptable)
+
+		problemRespond(w, r, errorf(r, err))
+		return
+	}
+
+	v, err := projectionRespond(r, contentType, v)
+	if err != nil {
+		problemRespond(w, r, errorf(r, err))
+		return
+	}
+
+	codecRespond(w, r, contentType, codec, v)
 }
 
 // JSON marshals 'v' to JSON, automatically escaping HTML and setting the
-// Content-Type as application/json.
+// Content-Type as application/json. Errors are rendered as
+// application/problem+json documents. The fields of the response are
+// selected by the fields query parameter, e.g. ?fields=id,name,owner.email.
+// It responds with 400 Bad Request if a selected field is unknown.
 func JSON(w http.ResponseWriter, r *http.Request, v interface{}) {
 	if err, ok := v.(error); ok {
-		v = errorf(r, err)
+		ProblemJSON(w, r, errorf(r, err))
+		return
+	}
+
+	v, err := projectionRespond(r, "application/json", v)
+	if err != nil {
+		ProblemJSON(w, r, errorf(r, err))
+		return
 	}
 
 	render.JSON(w, r, v)
@@ -29,10 +86,12 @@ func JSON(w http.ResponseWriter, r *http.Request, v interface{}) {
 
 // XML marshals 'v' to JSON, setting the Content-Type as application/xml. It
 // will automatically prepend a generic XML header (see encoding/xml.Header) if
-// one is not found in the first 100 bytes of 'v'.
+// one is not found in the first 100 bytes of 'v'. Errors are rendered as
+// application/problem+xml documents.
 func XML(w http.ResponseWriter, r *http.Request, v interface{}) {
 	if err, ok := v.(error); ok {
-		v = errorf(r, err)
+		ProblemXML(w, r, errorf(r, err))
+		return
 	}
 
 	render.XML(w, r, v)
@@ -55,6 +114,144 @@ func HTML(w http.ResponseWriter, r *http.Request, v string) {
 	render.HTML(w, r, v)
 }
 
+// EventStream sends the items of an Iterator or a channel as server-sent
+// events, setting the Content-Type as text/event-stream. The items can be
+// events or payloads of unnamed events. The events missed by a client that
+// reconnects with the Last-Event-ID header are replayed from the configured
+// store first. Heartbeats are sent periodically in order to keep the
+// connection alive. A received error is sent as an error event with a problem
+// payload and terminates the stream. The stream is logged by the Logger
+// middleware when it is closed.
+func EventStream(w http.ResponseWriter, r *http.Request, v interface{}, options ...EventStreamOption) {
+	config := &EventStreamConfig{
+		Heartbeat: DefaultEventHeartbeat,
+	}
+
+	for _, option := range options {
+		option(config)
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		err := errors.New("streaming is not supported").
+			AddTag("status", http.StatusInternalServerError)
+
+		problemRespond(w, r, errorf(r, err))
+		return
+	}
+
+	iterator, err := streamIterator(v)
+	if err != nil {
+		problemRespond(w, r, errorf(r, err))
+		return
+	}
+
+	var replay []*Event
+
+	if id := r.Header.Get("Last-Event-ID"); id != "" && config.Store != nil {
+		if replay, err = config.Store.Replay(r.Context(), id); err != nil {
+			problemRespond(w, r, errorf(r, err))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	middleware.LoggerStream(r)
+
+	w.Header().Set("Content-Type", ContentTypeEventStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	status := http.StatusOK
+
+	if code, ok := ctx.Value(render.StatusCtxKey).(int); ok {
+		status = code
+	}
+
+	w.WriteHeader(status)
+	flusher.Flush()
+
+	for _, event := range replay {
+		if _, err := event.WriteTo(w); err != nil {
+			return
+		}
+	}
+
+	flusher.Flush()
+
+	type message struct {
+		item interface{}
+		err  error
+	}
+
+	messages := make(chan message)
+
+	go func() {
+		defer close(messages)
+
+		for {
+			item, err := iterator.Next(ctx)
+
+			select {
+			case messages <- message{item: item, err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var heartbeat <-chan time.Time
+
+	if config.Heartbeat > 0 {
+		ticker := time.NewTicker(config.Heartbeat)
+		defer ticker.Stop()
+
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case msg, ok := <-messages:
+			if !ok || msg.err == io.EOF {
+				return
+			}
+
+			event := eventOf(msg.item)
+
+			if msg.err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				event = &Event{Name: "error", Data: errorf(r, msg.err)}
+			}
+
+			if _, err := event.WriteTo(w); err != nil {
+				return
+			}
+
+			if msg.err != nil {
+				flusher.Flush()
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
 // NoContent returns a HTTP 204 "No Content" response.
 func NoContent(w http.ResponseWriter, r *http.Request) {
 	render.NoContent(w, r)
@@ -0,0 +1,238 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/go-chi/render"
+	"github.com/go-playground/errors/v5"
+)
+
+// ContentTypeNDJSON is the media type of the newline delimited JSON streams
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// Iterator iterates over the items of a streamed response. Next returns io.EOF
+// when there are no more items.
+type Iterator interface {
+	Next(ctx context.Context) (interface{}, error)
+}
+
+// IteratorFunc is a function that implements the Iterator interface
+type IteratorFunc func(ctx context.Context) (interface{}, error)
+
+// Next returns the next item
+func (fn IteratorFunc) Next(ctx context.Context) (interface{}, error) {
+	return fn(ctx)
+}
+
+// StreamError is the terminal record of a stream that fails after some of its
+// items have been sent. The problem is built the same way as the error
+// responses.
+type StreamError struct {
+	Problem *Problem `json:"error"`
+}
+
+type streamFormat struct {
+	contentType string
+	array       bool
+}
+
+var (
+	streamNDJSON = streamFormat{contentType: ContentTypeNDJSON}
+	streamJSON   = streamFormat{contentType: "application/json; charset=utf-8", array: true}
+)
+
+// Stream streams the items of an Iterator or a channel as newline delimited
+// JSON, as JSON array or as server-sent events (see EventStream) depending on
+// the Accept header. The received errors terminate the stream. If no item has
+// been sent yet, the error is rendered as a problem response. Otherwise, a
+// StreamError record is sent as last item. The stream is stopped when the
+// client disconnects.
+func Stream(w http.ResponseWriter, r *http.Request, v interface{}) {
+	negotiateVary(w)
+
+	offer, ok := Negotiate(r, "application/json", ContentTypeNDJSON, ContentTypeEventStream)
+	if !ok {
+		err := errors.New("none of the acceptable media types is supported").
+			AddTag("status", http.StatusNotAcceptable)
+
+		problemRespond(w, r, errorf(r, err))
+		return
+	}
+
+	switch offer {
+	case ContentTypeNDJSON:
+		stream(w, r, v, streamNDJSON)
+		return
+	case ContentTypeEventStream:
+		EventStream(w, r, v)
+		return
+	}
+
+	stream(w, r, v, streamJSON)
+}
+
+// StreamNDJSON streams the items of an Iterator or a channel as newline
+// delimited JSON, setting the Content-Type as application/x-ndjson
+func StreamNDJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	stream(w, r, v, streamNDJSON)
+}
+
+// StreamJSON streams the items of an Iterator or a channel as JSON array,
+// setting the Content-Type as application/json
+func StreamJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	stream(w, r, v, streamJSON)
+}
+
+func stream(w http.ResponseWriter, r *http.Request, v interface{}, format streamFormat) {
+	iterator, err := streamIterator(v)
+	if err != nil {
+		problemRespond(w, r, errorf(r, err))
+		return
+	}
+
+	var (
+		ctx      = r.Context()
+		count    = 0
+		flusher  = streamFlusher(w)
+		encoder  = json.NewEncoder(w)
+		delimit  = func() error { return nil }
+		terminal interface{}
+	)
+
+	encoder.SetEscapeHTML(true)
+
+	if format.array {
+		delimit = func() error {
+			separator := ","
+			if count == 0 {
+				separator = "["
+			}
+
+			_, err := io.WriteString(w, separator)
+			return err
+		}
+	}
+
+	start := func() {
+		w.Header().Set("Content-Type", format.contentType)
+
+		if status, ok := ctx.Value(render.StatusCtxKey).(int); ok {
+			w.WriteHeader(status)
+		}
+	}
+
+	for {
+		// the client has disconnected
+		if ctx.Err() != nil {
+			return
+		}
+
+		item, err := iterator.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			// the status can be changed only before the first item
+			if count == 0 {
+				problemRespond(w, r, errorf(r, err))
+				return
+			}
+
+			terminal = &StreamError{Problem: errorf(r, err)}
+			break
+		}
+
+		if count == 0 {
+			start()
+		}
+
+		if err := delimit(); err != nil {
+			return
+		}
+
+		if err := encoder.Encode(item); err != nil {
+			return
+		}
+
+		count++
+		flusher()
+	}
+
+	if count == 0 {
+		start()
+	}
+
+	if terminal != nil {
+		if delimit() != nil || encoder.Encode(terminal) != nil {
+			return
+		}
+	}
+
+	if format.array {
+		if count == 0 {
+			//nolint:errcheck
+			io.WriteString(w, "[")
+		}
+
+		//nolint:errcheck
+		io.WriteString(w, "]\n")
+	}
+
+	flusher()
+}
+
+// streamIterator returns the iterator of an Iterator or a channel
+func streamIterator(v interface{}) (Iterator, error) {
+	if iterator, ok := v.(Iterator); ok {
+		return iterator, nil
+	}
+
+	value := reflect.ValueOf(v)
+
+	if value.Kind() != reflect.Chan || value.Type().ChanDir()&reflect.RecvDir == 0 {
+		err := errors.Newf("unable to stream %T", v).
+			AddTag("status", http.StatusInternalServerError)
+
+		return nil, err
+	}
+
+	next := func(ctx context.Context) (interface{}, error) {
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+			{Dir: reflect.SelectRecv, Chan: value},
+		}
+
+		switch index, item, ok := reflect.Select(cases); {
+		case index == 0:
+			return nil, ctx.Err()
+		case !ok:
+			return nil, io.EOF
+		default:
+			if err, ok := item.Interface().(error); ok {
+				return nil, err
+			}
+
+			return item.Interface(), nil
+		}
+	}
+
+	return IteratorFunc(next), nil
+}
+
+// streamFlusher returns a function that flushes the buffered data to the client
+func streamFlusher(w http.ResponseWriter) func() {
+	if flusher, ok := w.(http.Flusher); ok {
+		return flusher.Flush
+	}
+
+	return func() {}
+}
@@ -0,0 +1,158 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/go-playground/errors/v5"
+	"github.com/phogolabs/rest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream", func() {
+	var (
+		request  *http.Request
+		recorder *httptest.ResponseRecorder
+		items    chan interface{}
+	)
+
+	BeforeEach(func() {
+		request = httptest.NewRequest("GET", "http://example.com", nil)
+		recorder = httptest.NewRecorder()
+
+		items = make(chan interface{}, 3)
+		items <- Contact{Phone: "+188123451"}
+		items <- Contact{Phone: "+188123452"}
+	})
+
+	It("streams the items as JSON array", func() {
+		close(items)
+
+		rest.Stream(recorder, request, items)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Flushed).To(BeTrue())
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json; charset=utf-8"))
+
+		contacts := []Contact{}
+		Expect(json.NewDecoder(recorder.Body).Decode(&contacts)).To(Succeed())
+		Expect(contacts).To(HaveLen(2))
+		Expect(contacts[1].Phone).To(Equal("+188123452"))
+	})
+
+	It("streams the items as NDJSON", func() {
+		close(items)
+
+		request.Header.Set("Accept", "application/x-ndjson")
+
+		rest.Stream(recorder, request, items)
+		Expect(recorder.Header().Get("Content-Type")).To(Equal(rest.ContentTypeNDJSON))
+
+		lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(Equal(`{"phone":"+188123451"}`))
+	})
+
+	It("streams the items of a channel responded by Respond", func() {
+		close(items)
+
+		request.Header.Set("Accept", "application/x-ndjson")
+
+		rest.Respond(recorder, request, items)
+		Expect(recorder.Header().Get("Content-Type")).To(Equal(rest.ContentTypeNDJSON))
+
+		lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+	})
+
+	It("streams the items of a channel responded by Respond as events", func() {
+		close(items)
+
+		request.Header.Set("Accept", "text/event-stream")
+
+		rest.Respond(recorder, request, items)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(HavePrefix(rest.ContentTypeEventStream))
+		Expect(recorder.Body.String()).To(ContainSubstring(`data: {"phone":"+188123451"}`))
+	})
+
+	It("streams the items of an iterator", func() {
+		count := 0
+
+		iterator := rest.IteratorFunc(func(ctx context.Context) (interface{}, error) {
+			if count == 3 {
+				return nil, io.EOF
+			}
+
+			count++
+			return count, nil
+		})
+
+		rest.Respond(recorder, request, iterator)
+		Expect(recorder.Body.String()).To(Equal("[1\n,2\n,3\n]\n"))
+	})
+
+	It("streams an empty array", func() {
+		items = make(chan interface{})
+		close(items)
+
+		rest.StreamJSON(recorder, request, items)
+		Expect(recorder.Body.String()).To(Equal("[]\n"))
+	})
+
+	Context("when the stream fails", func() {
+		It("sends a terminal error record", func() {
+			items <- errors.New("oh no").AddTag("status", http.StatusServiceUnavailable)
+			close(items)
+
+			rest.StreamNDJSON(recorder, request, items)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+			Expect(lines).To(HaveLen(3))
+
+			record := &rest.StreamError{}
+			Expect(json.Unmarshal([]byte(lines[2]), record)).To(Succeed())
+			Expect(record.Problem.Status).To(Equal(http.StatusServiceUnavailable))
+			Expect(record.Problem.Detail).To(Equal("oh no"))
+		})
+
+		Context("when no item has been sent", func() {
+			It("responds with a problem", func() {
+				items = make(chan interface{}, 1)
+				items <- errors.New("oh no").AddTag("status", http.StatusServiceUnavailable)
+
+				rest.StreamJSON(recorder, request, items)
+				Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(recorder.Header().Get("Content-Type")).To(Equal("application/problem+json; charset=utf-8"))
+			})
+		})
+	})
+
+	Context("when the client disconnects", func() {
+		It("stops the stream", func() {
+			ctx, cancel := context.WithCancel(request.Context())
+			request = request.WithContext(ctx)
+
+			iterator := rest.IteratorFunc(func(ctx context.Context) (interface{}, error) {
+				cancel()
+				return "item", nil
+			})
+
+			rest.StreamNDJSON(recorder, request, iterator)
+			Expect(recorder.Body.String()).To(Equal("\"item\"\n"))
+		})
+	})
+
+	Context("when the value cannot be streamed", func() {
+		It("responds with a problem", func() {
+			rest.StreamJSON(recorder, request, "hello")
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+})
@@ -55,11 +55,13 @@ func TestREST(t *testing.T) {
 }
 
 var _ = BeforeSuite(func() {
-	rest.RegisterValidation("phone", func(field validator.FieldLevel) bool {
+	err := rest.RegisterValidation("phone", func(field validator.FieldLevel) bool {
 		phoneRegexp := regexp.MustCompile("\\+[0-9]+")
 		value := field.Field().String()
 		return phoneRegexp.MatchString(value)
 	})
+
+	Expect(err).To(Succeed())
 })
 
 func NewJSONRequest(data interface{}) *http.Request {
@@ -0,0 +1,217 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+)
+
+// TranslationFunc registers the validation messages of a locale
+type TranslationFunc func(v *validator.Validate, trans ut.Translator) error
+
+var (
+	translationMutex    sync.RWMutex
+	translationFallback = "en"
+	translationVersion  = 0
+	translationMap      = map[string]*translation{
+		"en": newTranslation(en.New(), entranslations.RegisterDefaultTranslations),
+	}
+)
+
+// translation is a translator that is shared by the validators built by
+// Validate. The messages are registered only by the first validator.
+type translation struct {
+	ut.Translator
+	register TranslationFunc
+}
+
+func newTranslation(locale locales.Translator, fn TranslationFunc) *translation {
+	trans, _ := ut.New(locale, locale).GetTranslator(locale.Locale())
+
+	return &translation{
+		Translator: trans,
+		register:   fn,
+	}
+}
+
+// Add adds a translation for a particular language/locale
+func (t *translation) Add(key interface{}, text string, override bool) error {
+	return t.ignore(t.Translator.Add(key, text, override))
+}
+
+// AddCardinal adds a cardinal plural translation for a particular language/locale
+func (t *translation) AddCardinal(key interface{}, text string, rule locales.PluralRule, override bool) error {
+	return t.ignore(t.Translator.AddCardinal(key, text, rule, override))
+}
+
+// AddOrdinal adds an ordinal plural translation for a particular language/locale
+func (t *translation) AddOrdinal(key interface{}, text string, rule locales.PluralRule, override bool) error {
+	return t.ignore(t.Translator.AddOrdinal(key, text, rule, override))
+}
+
+// AddRange adds a range plural translation for a particular language/locale
+func (t *translation) AddRange(key interface{}, text string, rule locales.PluralRule, override bool) error {
+	return t.ignore(t.Translator.AddRange(key, text, rule, override))
+}
+
+func (t *translation) ignore(err error) error {
+	// the message has been registered by a previously built validator
+	if _, ok := err.(*ut.ErrConflictingTranslation); ok {
+		return nil
+	}
+
+	return err
+}
+
+// RegisterTranslation registers a locale and the function that registers its
+// validation messages. The locale is chosen by the Accept-Language header.
+func RegisterTranslation(locale locales.Translator, fn TranslationFunc) {
+	trans := newTranslation(locale, fn)
+
+	translationMutex.Lock()
+	defer translationMutex.Unlock()
+
+	translationMap[strings.ToLower(locale.Locale())] = trans
+	// the validators have to register the messages of the new translator
+	translationVersion++
+}
+
+// RegisterTitle registers the title of the error responses with the given
+// status code for a locale registered by RegisterTranslation
+func RegisterTitle(locale string, status int, title string) error {
+	translationMutex.Lock()
+	defer translationMutex.Unlock()
+
+	trans, ok := translationMap[strings.ToLower(locale)]
+	if !ok {
+		return fmt.Errorf("translation: locale %q is not registered", locale)
+	}
+
+	return trans.Translator.Add(translationTitleKey(status), title, true)
+}
+
+// GetTranslator returns the translator of the most preferred locale of the
+// Accept-Language header. It falls back to English.
+func GetTranslator(r *http.Request) ut.Translator {
+	translationMutex.RLock()
+	defer translationMutex.RUnlock()
+
+	for _, locale := range translationLocales(r.Header.Get("Accept-Language")) {
+		// the locales use underscores as separator, e.g. en_US
+		locale = strings.ToLower(strings.Replace(locale, "-", "_", -1))
+
+		if trans, ok := translationMap[locale]; ok {
+			return trans
+		}
+
+		if index := strings.Index(locale, "_"); index != -1 {
+			if trans, ok := translationMap[locale[:index]]; ok {
+				return trans
+			}
+		}
+	}
+
+	return translationMap[translationFallback]
+}
+
+func translationTitle(trans ut.Translator, status int) string {
+	if trans != nil {
+		translationMutex.RLock()
+		defer translationMutex.RUnlock()
+
+		if title, err := trans.T(translationTitleKey(status)); err == nil {
+			return title
+		}
+	}
+
+	return http.StatusText(status)
+}
+
+func translationTitleKey(status int) string {
+	return "status:" + strconv.Itoa(status)
+}
+
+// translationRegister registers the messages of all locales and returns the
+// version of the registry
+func translationRegister(v *validator.Validate) (int, error) {
+	translationMutex.Lock()
+	defer translationMutex.Unlock()
+
+	for _, trans := range translationMap {
+		if trans.register == nil {
+			continue
+		}
+
+		if err := trans.register(v, trans); err != nil {
+			return 0, err
+		}
+	}
+
+	return translationVersion, nil
+}
+
+func translationCurrent() int {
+	translationMutex.RLock()
+	defer translationMutex.RUnlock()
+
+	return translationVersion
+}
+
+// translationLocales returns the language ranges of the Accept-Language header
+// ordered by their quality value
+func translationLocales(header string) []string {
+	type item struct {
+		value   string
+		quality float64
+	}
+
+	items := []item{}
+
+	for _, field := range strings.Split(header, ",") {
+		parts := strings.Split(field, ";")
+
+		entry := item{
+			value:   strings.TrimSpace(parts[0]),
+			quality: 1,
+		}
+
+		if entry.value == "" || entry.value == "*" {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+
+			if strings.HasPrefix(param, "q=") {
+				if quality, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					entry.quality = quality
+				}
+			}
+		}
+
+		if entry.quality > 0 {
+			items = append(items, entry)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].quality > items[j].quality
+	})
+
+	values := make([]string, 0, len(items))
+
+	for _, entry := range items {
+		values = append(values, entry.value)
+	}
+
+	return values
+}
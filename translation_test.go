@@ -0,0 +1,81 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-playground/locales/fr"
+	frtranslations "github.com/go-playground/validator/v10/translations/fr"
+	"github.com/phogolabs/rest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Translation", func() {
+	var request *http.Request
+
+	BeforeEach(func() {
+		rest.RegisterTranslation(fr.New(), frtranslations.RegisterDefaultTranslations)
+		Expect(rest.RegisterTitle("fr", http.StatusUnprocessableEntity, "Entité non traitable")).To(Succeed())
+
+		request = NewJSONRequest(&Person{Name: "Jack", Age: 18})
+	})
+
+	Describe("GetTranslator", func() {
+		It("returns the translator of the most preferred locale", func() {
+			request.Header.Set("Accept-Language", "de;q=0.5, fr-CH, en;q=0.8")
+			Expect(rest.GetTranslator(request).Locale()).To(Equal("fr"))
+		})
+
+		Context("when the locale is not registered", func() {
+			It("returns the English translator", func() {
+				request.Header.Set("Accept-Language", "de")
+				Expect(rest.GetTranslator(request).Locale()).To(Equal("en"))
+			})
+		})
+	})
+
+	Describe("RegisterTitle", func() {
+		Context("when the locale is not registered", func() {
+			It("returns an error", func() {
+				Expect(rest.RegisterTitle("de", http.StatusNotFound, "Nicht gefunden")).To(MatchError(`translation: locale "de" is not registered`))
+			})
+		})
+	})
+
+	It("responds with translated messages", func() {
+		request.Header.Set("Accept-Language", "fr-FR")
+
+		entity := &Person{}
+		err := rest.Decode(request, entity)
+		Expect(err).To(HaveOccurred())
+
+		recorder := httptest.NewRecorder()
+		rest.Respond(recorder, request, err)
+
+		problem := &rest.Problem{}
+		Expect(json.NewDecoder(recorder.Body).Decode(problem)).To(Succeed())
+		Expect(problem.Status).To(Equal(http.StatusUnprocessableEntity))
+		Expect(problem.Title).To(Equal("Entité non traitable"))
+		Expect(problem.Detail).To(Equal("age doit être 21 ou plus"))
+		Expect(problem.Extensions).To(HaveKeyWithValue("errors", ConsistOf(
+			HaveKeyWithValue("message", "age doit être 21 ou plus"),
+		)))
+	})
+
+	It("responds with English messages by default", func() {
+		entity := &Person{}
+		err := rest.Decode(request, entity)
+		Expect(err).To(HaveOccurred())
+
+		recorder := httptest.NewRecorder()
+		rest.Respond(recorder, request, err)
+
+		problem := &rest.Problem{}
+		Expect(json.NewDecoder(recorder.Body).Decode(problem)).To(Succeed())
+		Expect(problem.Title).To(Equal(http.StatusText(http.StatusUnprocessableEntity)))
+		Expect(problem.Detail).To(Equal("age must be 21 or greater"))
+	})
+})
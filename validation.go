@@ -1,36 +1,291 @@
 package rest
 
 import (
+	"encoding/xml"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/go-chi/render"
-	"github.com/go-playground/errors"
+	"github.com/go-playground/errors/v5"
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
 )
 
-var (
-	validationFuncMap = make(map[string]validator.Func)
-)
+// DefaultValidator is the validator used by Validate
+var DefaultValidator = NewValidator()
+
+// FieldError represents a single field validation failure
+type FieldError struct {
+	Field   string      `json:"field" xml:"field"`
+	Tag     string      `json:"tag" xml:"tag"`
+	Param   string      `json:"param,omitempty" xml:"param,omitempty"`
+	Value   interface{} `json:"value,omitempty" xml:"value,omitempty"`
+	Message string      `json:"message" xml:"message"`
+	Source  string      `json:"source,omitempty" xml:"source,omitempty"`
+}
+
+// MarshalXML marshals the field error as XML element
+func (e FieldError) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	members := []struct {
+		key   string
+		value interface{}
+	}{
+		{key: "field", value: e.Field},
+		{key: "tag", value: e.Tag},
+		{key: "param", value: e.Param},
+		{key: "value", value: e.Value},
+		{key: "message", value: e.Message},
+		{key: "source", value: e.Source},
+	}
+
+	for _, member := range members {
+		if member.value == "" {
+			continue
+		}
+
+		if err := xmlEncode(encoder, member.key, member.value); err != nil {
+			return err
+		}
+	}
+
+	return encoder.EncodeToken(start.End())
+}
 
-// RegisterValidation adds a validation with the given tag
-func RegisterValidation(tag string, fn validator.Func) {
-	validationFuncMap[tag] = fn
+// FieldErrors returns the field errors of a validation error. The field path
+// is composed from the names computed by the tag name function of Validate.
+func FieldErrors(err error) []FieldError {
+	return TranslateFieldErrors(err, nil)
+}
+
+// TranslateFieldErrors returns the field errors of a validation error with
+// messages in the language of the given translator
+func TranslateFieldErrors(err error, trans ut.Translator) []FieldError {
+	var (
+		verrs validator.ValidationErrors
+		errs  = []FieldError{}
+	)
+
+	if !errors.As(err, &verrs) {
+		return errs
+	}
+
+	// the sources are reported by DecodeRequest
+	sources, _ := errors.LookupTag(err, "sources").(map[string]string)
+
+	for _, verr := range verrs {
+		field := fieldPath(verr.Namespace(), verr.Field())
+
+		message := verr.Error()
+
+		if trans != nil {
+			translationMutex.RLock()
+			message = verr.Translate(trans)
+			translationMutex.RUnlock()
+		}
+
+		errs = append(errs, FieldError{
+			Field:   field,
+			Tag:     verr.Tag(),
+			Param:   verr.Param(),
+			Value:   verr.Value(),
+			Message: message,
+			Source:  sources[field],
+		})
+	}
+
+	return errs
+}
+
+// Validator validates the request entities. It builds a validator per tag
+// name strategy and caches it, so the struct cache of the validator is reused
+// across the requests. It is safe for concurrent use.
+type Validator struct {
+	mutex   sync.RWMutex
+	cache   map[validationStrategy]*validation
+	options []validationOption
+}
+
+// validationStrategy determines the names of the fields reported by the
+// validator
+type validationStrategy struct {
+	kind    render.ContentType
+	request bool
+}
+
+type validation struct {
+	validate *validator.Validate
+	version  int
+}
+
+type validationOption func(v *validator.Validate) error
+
+// NewValidator creates a new validator. The uploaded files can be validated
+// with the filesize and filetype tags.
+func NewValidator() *Validator {
+	return &Validator{
+		cache: make(map[validationStrategy]*validation),
+		options: []validationOption{
+			func(validate *validator.Validate) error {
+				validate.RegisterCustomTypeFunc(validationFile, multipart.FileHeader{}, File{})
+				return nil
+			},
+			func(validate *validator.Validate) error {
+				return validate.RegisterValidation("filesize", validateFileSize)
+			},
+			func(validate *validator.Validate) error {
+				return validate.RegisterValidation("filetype", validateFileType)
+			},
+		},
+	}
+}
+
+// RegisterValidation adds a validation with the given tag. The error is
+// returned if the tag is restricted or the function is nil.
+func (v *Validator) RegisterValidation(tag string, fn validator.Func, callEvenIfNull ...bool) error {
+	return v.register(func(validate *validator.Validate) error {
+		return validate.RegisterValidation(tag, fn, callEvenIfNull...)
+	})
+}
+
+// RegisterStructValidation registers a struct level validation for the given
+// types
+func (v *Validator) RegisterStructValidation(fn validator.StructLevelFunc, types ...interface{}) error {
+	return v.register(func(validate *validator.Validate) error {
+		validate.RegisterStructValidation(fn, types...)
+		return nil
+	})
+}
+
+// RegisterCustomTypeFunc registers a function that returns the value to be
+// validated for the given types, e.g. sql.NullString
+func (v *Validator) RegisterCustomTypeFunc(fn validator.CustomTypeFunc, types ...interface{}) error {
+	return v.register(func(validate *validator.Validate) error {
+		validate.RegisterCustomTypeFunc(fn, types...)
+		return nil
+	})
+}
+
+// RegisterAlias registers an alias of one or more tags. The error is returned
+// if the alias is a restricted tag.
+func (v *Validator) RegisterAlias(alias, tags string) error {
+	return v.register(func(validate *validator.Validate) error {
+		validate.RegisterAlias(alias, tags)
+		return nil
+	})
 }
 
 // Validate validates a data
-func Validate(r *http.Request, data interface{}) error {
-	v := validator.New()
+func (v *Validator) Validate(r *http.Request, data interface{}) error {
+	strategy := validationStrategy{
+		kind: requestContentType(r),
+	}
+
+	return v.validate(r, data, strategy)
+}
+
+// ValidateRequest validates a data decoded by DecodeRequest. The fields are
+// named after their path, query or header tag if they have one.
+func (v *Validator) ValidateRequest(r *http.Request, data interface{}) error {
+	strategy := validationStrategy{
+		kind:    requestContentType(r),
+		request: true,
+	}
+
+	return v.validate(r, data, strategy)
+}
+
+func (v *Validator) validate(r *http.Request, data interface{}, strategy validationStrategy) error {
+	validate, err := v.validator(strategy)
+	if err != nil {
+		return errors.WrapSkipFrames(err, "validate", 3).AddTag("status", http.StatusInternalServerError)
+	}
+
+	if err := validate.StructCtx(r.Context(), data); err != nil {
+		return errors.WrapSkipFrames(err, "validate", 3).AddTag("status", http.StatusUnprocessableEntity)
+	}
+
+	return nil
+}
+
+func (v *Validator) register(option validationOption) error {
+	// the option is applied on a new validator in order to report the error
+	// before the option is used by the cached validators
+	if err := validationApply(option, validator.New()); err != nil {
+		return err
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.options = append(v.options, option)
+	// the validators must not be modified while they are in use
+	v.cache = make(map[validationStrategy]*validation)
 
-	for key, fn := range validationFuncMap {
-		if err := v.RegisterValidation(key, fn); err != nil {
-			return errors.WrapSkipFrames(err, "validate", 2).AddTag("status", http.StatusInternalServerError)
+	return nil
+}
+
+// validationApply applies the option on the validator. The validator panics
+// for the restricted tags and aliases, so the panic is returned as an error.
+func validationApply(option validationOption, validate *validator.Validate) (err error) {
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			err = fmt.Errorf("%v", rvr)
 		}
+	}()
+
+	return option(validate)
+}
+
+// validator returns the validator of the given content type
+func (v *Validator) validator(strategy validationStrategy) (*validator.Validate, error) {
+	version := translationCurrent()
+
+	v.mutex.RLock()
+	entry, ok := v.cache[strategy]
+	v.mutex.RUnlock()
+
+	if ok && entry.version == version {
+		return entry.validate, nil
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if entry, ok = v.cache[strategy]; ok && entry.version == version {
+		return entry.validate, nil
 	}
 
-	v.RegisterTagNameFunc(func(field reflect.StructField) string {
-		switch render.GetRequestContentType(r) {
+	validate := validator.New()
+
+	for _, option := range v.options {
+		if err := option(validate); err != nil {
+			return nil, err
+		}
+	}
+
+	version, err := translationRegister(validate)
+	if err != nil {
+		return nil, err
+	}
+
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		if strategy.request {
+			for _, attr := range []string{"path", "query", "header"} {
+				if name := tagName(field, attr); name != "" {
+					return name
+				}
+			}
+		}
+
+		switch strategy.kind {
 		case render.ContentTypeJSON:
 			return tagName(field, "json")
 		case render.ContentTypeXML:
@@ -42,11 +297,62 @@ func Validate(r *http.Request, data interface{}) error {
 		}
 	})
 
-	if err := v.StructCtx(r.Context(), data); err != nil {
-		return errors.WrapSkipFrames(err, "validate", 2).AddTag("status", http.StatusUnprocessableEntity)
+	v.cache[strategy] = &validation{
+		validate: validate,
+		version:  version,
 	}
 
-	return nil
+	return validate, nil
+}
+
+// RegisterValidation adds a validation with the given tag to the default
+// validator. The error is returned if the tag is restricted or the function is
+// nil. Note that returning the error is a breaking change of the former
+// RegisterValidation(tag, fn) signature.
+func RegisterValidation(tag string, fn validator.Func, callEvenIfNull ...bool) error {
+	return DefaultValidator.RegisterValidation(tag, fn, callEvenIfNull...)
+}
+
+// RegisterStructValidation registers a struct level validation for the given
+// types to the default validator
+func RegisterStructValidation(fn validator.StructLevelFunc, types ...interface{}) error {
+	return DefaultValidator.RegisterStructValidation(fn, types...)
+}
+
+// RegisterCustomTypeFunc registers a custom type function for the given types
+// to the default validator
+func RegisterCustomTypeFunc(fn validator.CustomTypeFunc, types ...interface{}) error {
+	return DefaultValidator.RegisterCustomTypeFunc(fn, types...)
+}
+
+// RegisterAlias registers an alias of one or more tags to the default
+// validator
+func RegisterAlias(alias, tags string) error {
+	return DefaultValidator.RegisterAlias(alias, tags)
+}
+
+// Validate validates a data with the default validator
+func Validate(r *http.Request, data interface{}) error {
+	return DefaultValidator.Validate(r, data)
+}
+
+// ValidateRequest validates a data decoded by DecodeRequest with the default
+// validator
+func ValidateRequest(r *http.Request, data interface{}) error {
+	return DefaultValidator.ValidateRequest(r, data)
+}
+
+func fieldPath(namespace, field string) string {
+	// the root element is the name of the validated struct
+	if index := strings.Index(namespace, "."); index != -1 {
+		namespace = namespace[index+1:]
+	}
+
+	if namespace == "" {
+		namespace = field
+	}
+
+	return namespace
 }
 
 func tagName(field reflect.StructField, attr string) string {
@@ -0,0 +1,147 @@
+package rest_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/phogolabs/rest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validator", func() {
+	var (
+		request *http.Request
+		checker *rest.Validator
+	)
+
+	BeforeEach(func() {
+		request = NewJSONRequest(nil)
+		checker = rest.NewValidator()
+	})
+
+	It("validates the entity", func() {
+		Expect(checker.Validate(request, &Person{Age: 21})).To(Succeed())
+		Expect(checker.Validate(request, &Person{Age: 20})).NotTo(Succeed())
+	})
+
+	It("validates the entity concurrently", func() {
+		group := sync.WaitGroup{}
+
+		for index := 0; index < 10; index++ {
+			group.Add(1)
+
+			go func() {
+				defer GinkgoRecover()
+				defer group.Done()
+
+				Expect(checker.Validate(NewJSONRequest(nil), &Person{Age: 21})).To(Succeed())
+			}()
+		}
+
+		group.Wait()
+	})
+
+	Describe("RegisterValidation", func() {
+		It("registers the validation", func() {
+			fn := func(field validator.FieldLevel) bool {
+				return field.Field().String() == "Jack"
+			}
+
+			Expect(checker.RegisterValidation("jack", fn)).To(Succeed())
+
+			type User struct {
+				Name string `json:"name" validate:"jack"`
+			}
+
+			Expect(checker.Validate(request, &User{Name: "Jack"})).To(Succeed())
+			Expect(checker.Validate(request, &User{Name: "John"})).NotTo(Succeed())
+		})
+
+		Context("when the function is nil", func() {
+			It("returns an error", func() {
+				Expect(checker.RegisterValidation("jack", nil)).To(MatchError("function cannot be empty"))
+			})
+		})
+
+		Context("when the tag is restricted", func() {
+			It("returns an error", func() {
+				fn := func(field validator.FieldLevel) bool {
+					return true
+				}
+
+				err := checker.RegisterValidation("required", fn)
+				Expect(err).To(MatchError(ContainSubstring("restricted")))
+			})
+		})
+	})
+
+	Describe("RegisterStructValidation", func() {
+		It("registers the validation", func() {
+			fn := func(sl validator.StructLevel) {
+				person := sl.Current().Interface().(Person)
+
+				if person.Name == "" {
+					sl.ReportError(person.Name, "name", "Name", "required", "")
+				}
+			}
+
+			Expect(checker.RegisterStructValidation(fn, Person{})).To(Succeed())
+
+			err := checker.Validate(request, &Person{Age: 21})
+			Expect(err).To(HaveOccurred())
+
+			errs := rest.FieldErrors(err)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("name"))
+			Expect(errs[0].Tag).To(Equal("required"))
+		})
+	})
+
+	Describe("RegisterCustomTypeFunc", func() {
+		It("registers the function", func() {
+			fn := func(field reflect.Value) interface{} {
+				if valuer, ok := field.Interface().(driver.Valuer); ok {
+					if value, err := valuer.Value(); err == nil {
+						return value
+					}
+				}
+
+				return nil
+			}
+
+			Expect(checker.RegisterCustomTypeFunc(fn, sql.NullString{})).To(Succeed())
+
+			type User struct {
+				Name sql.NullString `json:"name" validate:"required"`
+			}
+
+			Expect(checker.Validate(request, &User{Name: sql.NullString{String: "Jack", Valid: true}})).To(Succeed())
+			Expect(checker.Validate(request, &User{})).NotTo(Succeed())
+		})
+	})
+
+	Describe("RegisterAlias", func() {
+		It("registers the alias", func() {
+			Expect(checker.RegisterAlias("adult", "gte=21")).To(Succeed())
+
+			type User struct {
+				Age int `json:"age" validate:"adult"`
+			}
+
+			Expect(checker.Validate(request, &User{Age: 21})).To(Succeed())
+			Expect(checker.Validate(request, &User{Age: 20})).NotTo(Succeed())
+		})
+
+		Context("when the alias is restricted", func() {
+			It("returns an error", func() {
+				Expect(checker.RegisterAlias("dive", "gte=21")).To(HaveOccurred())
+			})
+		})
+	})
+})